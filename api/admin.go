@@ -0,0 +1,336 @@
+// 管理用のAPI
+// 管理画面(public/admin)から使う
+// 閲覧はviewer、ジョブの実行とスケジュールの変更はeditor、ライブラリとトークンの管理はadminが必要
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/job"
+	"github.com/yaegaki/ohohoi-bank/jobrun"
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
+)
+
+const (
+	defaultAdminListLimit = 20
+	maxAdminListLimit     = 100
+)
+
+type jobsResponse struct {
+	Status jobrun.Status `json:"status"`
+	// Stale 最後に成功してから時間が経ちすぎている
+	Stale bool          `json:"stale"`
+	Runs  []*jobrun.Run `json:"runs"`
+}
+
+type renumberRequest struct {
+	ByPublishedAt bool `json:"byPublishedAt"`
+	// Apply falseの場合は変更点を返すだけで書き込まない
+	Apply bool `json:"apply"`
+}
+
+type renumberResponse struct {
+	Applied bool                     `json:"applied"`
+	Changes []library.RenumberChange `json:"changes"`
+}
+
+type createTokenRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type createTokenResponse struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+// parseLimit limitパラメーターを取得する
+func parseLimit(c echo.Context) (int, error) {
+	v := c.QueryParam("limit")
+	if v == "" {
+		return defaultAdminListLimit, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > maxAdminListLimit {
+		return 0, errInvalidParameter{"limit", v, fmt.Sprintf("must be between 1 and %v", maxAdminListLimit)}
+	}
+	return n, nil
+}
+
+// jobsHandler 直近のジョブの実行履歴と最後に成功した日時を返す
+func jobsHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	s, err := jobrun.GetStatus(ctx, client)
+	if err != nil {
+		return errStorage(err)
+	}
+	runs, err := jobrun.List(ctx, client, limit)
+	if err != nil {
+		return errStorage(err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, jobsResponse{
+		Status: s,
+		Stale:  s.Stale(time.Now()),
+		Runs:   runs,
+	})
+}
+
+// triggerExportHandler job.Exportを実行する
+// 監査ログには実行した結果も記録する
+func (sv *server) triggerExportHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+
+	err = job.RunExport(ctx, sv.opts.Job)
+	writeAudit(ctx, client, "job.export", "export", jobAuditDetail(err))
+	if err != nil {
+		return errJobFailed("export", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// deleteScheduleHandler 明日以降のスケジュールを削除する
+// 削除したスケジュールは次のjob.Exportで作り直される
+// 放送中のスケジュールは視聴者に影響するので削除できない
+// 進めたシリーズのカーソルも戻すので、後の日付のスケジュールがシリーズの続きから作成されている場合は先にそちらを削除する
+func deleteScheduleHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	date := c.Param("date")
+	day, err := broadcast.ParseKey(date)
+	if err != nil {
+		return errBadRequest(errInvalidParameter{"date", date, "must be YYYY-MM-DD"})
+	}
+	if !day.After(broadcast.Today()) {
+		return errBadRequest(errInvalidParameter{"date", date, "must be after today"})
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	key := broadcast.Key(day)
+	err = schedule.Delete(ctx, client, day)
+	if e, ok := err.(schedule.ErrLaterSchedule); ok {
+		return &httpError{
+			Status:  http.StatusConflict,
+			Code:    "later_schedule",
+			Message: fmt.Sprintf("schedule %v depends on this schedule, delete it first", e.Date),
+		}
+	}
+	if err != nil {
+		return errStorage(err)
+	}
+	writeAudit(ctx, client, "schedule.delete", key, "")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func libraryCheckHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	videos, statistics, err := library.Load(ctx, client)
+	if err != nil {
+		return errStorage(err)
+	}
+
+	return c.JSON(http.StatusOK, library.Check(videos, statistics.VideoCount))
+}
+
+// libraryRenumberHandler Numberを振り直す
+// youtube.ExportVideosと同時に実行されないようにexport-videoのロックを取得してから行う
+func libraryRenumberHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req renumberRequest
+	err := c.Bind(&req)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+
+	var lock *lease.Lock
+	if req.Apply {
+		lock, err = lease.AcquireLock(ctx, client, "export-video", lease.ExportTTL)
+		if _, ok := err.(lease.ErrLockHeld); ok {
+			return &httpError{
+				Status:  http.StatusConflict,
+				Code:    "locked",
+				Message: "export video is running",
+			}
+		}
+		if err != nil {
+			return errStorage(err)
+		}
+		defer lock.Release(ctx)
+	}
+
+	videos, statistics, err := library.Load(ctx, client)
+	if err != nil {
+		return errStorage(err)
+	}
+	changes := library.PlanRenumber(videos, req.ByPublishedAt)
+
+	if req.Apply {
+		err = library.ApplyRenumber(ctx, lock, client, changes, statistics.VideoCount, len(videos))
+		if err != nil {
+			return errStorage(err)
+		}
+		writeAudit(ctx, client, "library.renumber", "Video", fmt.Sprintf("%v changes, byPublishedAt=%v", len(changes), req.ByPublishedAt))
+	}
+
+	return c.JSON(http.StatusOK, renumberResponse{
+		Applied: req.Apply,
+		Changes: changes,
+	})
+}
+
+func listTokensHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	tokens, err := listAPITokens(ctx, client)
+	if err != nil {
+		return errStorage(err)
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// createTokenHandler トークンを作成する
+// トークンはこのレスポンスでしか返さない
+func createTokenHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req createTokenRequest
+	err := c.Bind(&req)
+	if err != nil {
+		return errBadRequest(err)
+	}
+	if req.Name == "" {
+		return errBadRequest(errInvalidParameter{"name", req.Name, "must not be empty"})
+	}
+	r, err := parseRole(req.Role)
+	if err != nil {
+		return errBadRequest(errInvalidParameter{"role", req.Role, "must be viewer, editor or admin"})
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	token, err := createAPIToken(ctx, client, req.Name, r)
+	if err != nil {
+		return errStorage(err)
+	}
+	id := hashToken(token)
+	writeAudit(ctx, client, "token.create", id, fmt.Sprintf("name=%v role=%v", req.Name, r))
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusCreated, createTokenResponse{
+		ID:    id,
+		Token: token,
+	})
+}
+
+func deleteTokenHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	id := c.Param("id")
+	err = deleteAPIToken(ctx, client, id)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return errStorage(err)
+	}
+	writeAudit(ctx, client, "token.delete", id, "")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func auditHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	entries, err := listAudit(ctx, client, limit)
+	if err != nil {
+		return errStorage(err)
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, entries)
+}
+
+// configHandler 読み込んだ設定を返す
+func (sv *server) configHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, sv.opts.Config)
+}
+
+func (sv *server) registerAdmin(e *echo.Echo) {
+	g := e.Group("/admin/api")
+	viewer := requireRole(roleViewer)
+	editor := requireRole(roleEditor)
+	admin := requireRole(roleAdmin)
+
+	g.GET("/jobs", jobsHandler, viewer)
+	g.POST("/jobs/export", sv.triggerExportHandler, editor)
+	g.DELETE("/schedules/:date", deleteScheduleHandler, editor)
+	g.GET("/library/check", libraryCheckHandler, viewer)
+	g.POST("/library/renumber", libraryRenumberHandler, admin)
+	g.GET("/tokens", listTokensHandler, admin)
+	g.POST("/tokens", createTokenHandler, admin)
+	g.DELETE("/tokens/:id", deleteTokenHandler, admin)
+	g.GET("/audit", auditHandler, admin)
+	g.GET("/config", sv.configHandler, admin)
+}
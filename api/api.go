@@ -0,0 +1,185 @@
+// 外部に公開するAPI(v1)
+// 内部の構造体をそのまま返すと変更がクライアントに影響するので、形式を固定した構造体に変換して返す
+// 形式はpublic/api/v1/openapi.jsonに記載している
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+type apiItem struct {
+	VideoID string `json:"videoId"`
+	// Start, End RFC 3339形式のUTCの時刻
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// DurationSeconds 長さ(秒)
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Duration ISO 8601形式の長さ
+	Duration string `json:"duration"`
+	// Live ライブ配信の同時放送、終了時刻は決まっていないので長さは配信開始からの経過時間
+	Live bool `json:"live,omitempty"`
+}
+
+type apiChannel struct {
+	// ID 1から始まるチャンネルの番号
+	ID    int       `json:"id"`
+	Name  string    `json:"name"`
+	Items []apiItem `json:"items"`
+}
+
+type apiSchedule struct {
+	Zone     string       `json:"zone"`
+	Start    string       `json:"start,omitempty"`
+	End      string       `json:"end,omitempty"`
+	Channels []apiChannel `json:"channels"`
+}
+
+type apiNowChannel struct {
+	ID            int      `json:"id"`
+	Name          string   `json:"name"`
+	Current       *apiItem `json:"current"`
+	OffsetSeconds float64  `json:"offsetSeconds"`
+	Next          *apiItem `json:"next"`
+}
+
+type apiNow struct {
+	ServerTime string          `json:"serverTime"`
+	Zone       string          `json:"zone"`
+	Channels   []apiNowChannel `json:"channels"`
+}
+
+func formatAPITime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatISODuration ISO 8601形式(PT1H2M3S)にする
+func formatISODuration(d time.Duration) string {
+	if d <= 0 {
+		return "PT0S"
+	}
+
+	s := "PT"
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	if h > 0 {
+		s += fmt.Sprintf("%dH", h)
+	}
+	if m > 0 {
+		s += fmt.Sprintf("%dM", m)
+	}
+	if d > 0 {
+		s += fmt.Sprintf("%gS", d.Seconds())
+	}
+
+	return s
+}
+
+// ChannelName ChannelNamesで指定した名前を返す
+func (o Options) ChannelName(i int) string {
+	if i < len(o.ChannelNames) && o.ChannelNames[i] != "" {
+		return o.ChannelNames[i]
+	}
+	return fmt.Sprintf("Channel %v", i+1)
+}
+
+func toAPIItem(it schedule.Item) apiItem {
+	return apiItem{
+		VideoID:         it.VideoID,
+		Start:           formatAPITime(it.Time),
+		End:             formatAPITime(it.Time.Add(it.Duration)),
+		DurationSeconds: it.Duration.Seconds(),
+		Duration:        formatISODuration(it.Duration),
+		Live:            it.Live,
+	}
+}
+
+func toAPISchedule(s schedule.Schedule, w scheduleWindow, opts Options) apiSchedule {
+	result := apiSchedule{
+		Zone:     broadcast.Location.String(),
+		Channels: make([]apiChannel, 0, len(w.Channels)),
+	}
+	// atを省略した場合はレスポンスを次に番組が切り替わるまで使いまわすので、最初のリクエストの範囲は返さない
+	if w.Fixed {
+		result.Start = formatAPITime(w.Start)
+		result.End = formatAPITime(w.Start.Add(w.Duration))
+	}
+
+	for _, c := range selectChannels(s, w.Channels) {
+		items := make([]apiItem, 0, len(c.Items))
+		for _, it := range c.Items {
+			items = append(items, toAPIItem(it))
+		}
+
+		result.Channels = append(result.Channels, apiChannel{
+			ID:    c.Number,
+			Name:  opts.ChannelName(c.Number - 1),
+			Items: items,
+		})
+	}
+
+	return result
+}
+
+func toAPINow(now schedule.Now, opts Options) apiNow {
+	result := apiNow{
+		ServerTime: formatAPITime(now.ServerTime),
+		Zone:       now.Zone,
+		Channels:   make([]apiNowChannel, 0, len(now.Channels)),
+	}
+
+	for i, c := range now.Channels {
+		result.Channels = append(result.Channels, toAPINowChannel(i, c, opts))
+	}
+
+	return result
+}
+
+// toAPINowChannel i番目(0から)のチャンネルを変換する
+func toAPINowChannel(i int, c schedule.NowChannel, opts Options) apiNowChannel {
+	ch := apiNowChannel{
+		ID:            i + 1,
+		Name:          opts.ChannelName(i),
+		OffsetSeconds: c.Offset.Seconds(),
+	}
+	if c.Current != nil {
+		current := toAPIItem(*c.Current)
+		ch.Current = &current
+	}
+	if c.Next != nil {
+		next := toAPIItem(*c.Next)
+		ch.Next = &next
+	}
+	return ch
+}
+
+func (sv *server) apiScheduleHandler(c echo.Context) error {
+	return sv.writeScheduleResponse(c, func(s schedule.Schedule, w scheduleWindow) interface{} {
+		return toAPISchedule(s, w, sv.opts)
+	})
+}
+
+func (sv *server) apiNowHandler(c echo.Context) error {
+	n, err := sv.loadNow(c)
+	if err != nil {
+		return err
+	}
+
+	// 現在時刻を返すのでキャッシュさせない
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, toAPINow(n, sv.opts))
+}
+
+func (sv *server) registerAPIv1(e *echo.Echo) {
+	g := e.Group("/api/v1")
+	g.GET("/schedule", sv.apiScheduleHandler)
+	g.GET("/now", sv.apiNowHandler)
+}
@@ -0,0 +1,85 @@
+// 監査ログ
+// 管理用APIでの変更を誰がいつ行ったかをAuditLogコレクションに記録する
+package api
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+type auditEntry struct {
+	Time      time.Time `firestore:"time" json:"time"`
+	Actor     string    `firestore:"actor" json:"actor"`
+	Role      string    `firestore:"role" json:"role"`
+	Action    string    `firestore:"action" json:"action"`
+	Target    string    `firestore:"target" json:"target"`
+	Detail    string    `firestore:"detail" json:"detail,omitempty"`
+	RequestID string    `firestore:"requestId" json:"requestId,omitempty"`
+}
+
+// writeAudit ctxの主体がtargetに対してactionを行ったことを記録する
+// 記録に失敗しても変更自体は取り消せないので、ログに出力するだけにする
+func writeAudit(ctx context.Context, storeClient *firestore.Client, action, target, detail string) {
+	e := auditEntry{
+		Time:   time.Now(),
+		Action: action,
+		Target: target,
+		Detail: detail,
+	}
+	if p, ok := getPrincipal(ctx); ok {
+		e.Actor = p.Name
+		e.Role = p.Role.String()
+	}
+	e.RequestID = logging.RequestID(ctx)
+
+	_, _, err := storeClient.Collection("AuditLog").Add(ctx, e)
+	fields := logging.Fields{
+		"actor":  e.Actor,
+		"action": action,
+		"target": target,
+	}
+	if err != nil {
+		fields["error"] = err
+		logging.Error(ctx, "Can't write audit log", fields)
+		return
+	}
+	logging.Info(ctx, "audit", fields)
+}
+
+// jobAuditDetail ジョブの実行結果を監査ログの詳細にする
+func jobAuditDetail(err error) string {
+	if err != nil {
+		return "failure: " + err.Error()
+	}
+	return "success"
+}
+
+// listAudit 新しい順にlimit件返す
+func listAudit(ctx context.Context, storeClient *firestore.Client, limit int) ([]auditEntry, error) {
+	docs, err := storeClient.Collection("AuditLog").
+		OrderBy("time", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+	metrics.CountFirestoreReads("audit_log", len(docs))
+
+	result := make([]auditEntry, 0, len(docs))
+	for _, doc := range docs {
+		var e auditEntry
+		err = doc.DataTo(&e)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+
+	return result, nil
+}
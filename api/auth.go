@@ -0,0 +1,256 @@
+// 管理用APIの認証と権限
+// APIトークンはハッシュにしてApiTokenコレクションに保存し、トークンごとにロールを持たせる
+// 最初のトークンを作成するためにSIRO4_ADMIN_TOKENは常にadminとして扱う
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/cache"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+	"github.com/yaegaki/ohohoi-bank/store"
+)
+
+type role int
+
+const (
+	roleNone role = iota
+	// roleViewer 履歴や状態の閲覧
+	roleViewer
+	// roleEditor ジョブの実行やスケジュールの変更
+	roleEditor
+	// roleAdmin ライブラリの変更、トークンと設定の管理
+	roleAdmin
+)
+
+var roleNames = map[role]string{
+	roleViewer: "viewer",
+	roleEditor: "editor",
+	roleAdmin:  "admin",
+}
+
+func (r role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+func parseRole(s string) (role, error) {
+	for r, name := range roleNames {
+		if name == s {
+			return r, nil
+		}
+	}
+	return roleNone, fmt.Errorf("unknown role %q", s)
+}
+
+type apiToken struct {
+	Name      string    `firestore:"name" json:"name"`
+	Role      string    `firestore:"role" json:"role"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	CreatedBy string    `firestore:"createdBy" json:"createdBy"`
+}
+
+// principal 認証されたリクエストの主体
+type principal struct {
+	Name string
+	Role role
+}
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// トークンを無効にしてから反映されるまでの時間
+const apiTokenCacheTTL = time.Minute
+
+// 存在しないトークンは短い時間だけ別に覚えておく
+// 不正なトークンが大量に送られても有効なトークンのキャッシュが破棄されないようにする
+const apiTokenMissCacheTTL = 10 * time.Second
+
+var (
+	apiTokenCache     = cache.NewBounded(1000)
+	apiTokenMissCache = cache.NewBounded(1000)
+)
+
+func withPrincipal(ctx context.Context, p principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+func getPrincipal(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey).(principal)
+	return p, ok
+}
+
+// hashToken トークンはそのまま保存せず、ハッシュをドキュメントのIDにする
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func bearerToken(c echo.Context) string {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// lookupToken トークンに対応する主体を返す
+// 存在しない場合はroleNoneを返す
+func lookupToken(ctx context.Context, storeClient *firestore.Client, token string) (principal, error) {
+	if admin := os.Getenv("SIRO4_ADMIN_TOKEN"); admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return principal{Name: "bootstrap", Role: roleAdmin}, nil
+	}
+
+	id := hashToken(token)
+	if v, ok := apiTokenCache.Get(id); ok {
+		return v.(principal), nil
+	}
+	if _, ok := apiTokenMissCache.Get(id); ok {
+		return principal{Role: roleNone}, nil
+	}
+
+	metrics.CountFirestoreReads("api_token", 1)
+	snap, err := storeClient.Collection("ApiToken").Doc(id).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return principal{}, err
+	}
+
+	if !snap.Exists() {
+		apiTokenMissCache.Set(id, struct{}{}, apiTokenMissCacheTTL)
+		return principal{Role: roleNone}, nil
+	}
+
+	var t apiToken
+	err = snap.DataTo(&t)
+	if err != nil {
+		return principal{}, err
+	}
+	r, err := parseRole(t.Role)
+	if err != nil {
+		return principal{}, err
+	}
+	p := principal{Name: t.Name, Role: r}
+
+	apiTokenCache.Set(id, p, apiTokenCacheTTL)
+	return p, nil
+}
+
+// authenticate リクエストの主体を返す
+// DEVELOPの場合はトークンがなくてもadminとして扱う
+func authenticate(c echo.Context) (principal, error) {
+	token := bearerToken(c)
+	if token == "" {
+		if os.Getenv("DEVELOP") == "true" {
+			return principal{Name: "develop", Role: roleAdmin}, nil
+		}
+		return principal{Role: roleNone}, nil
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return principal{}, err
+	}
+	return lookupToken(c.Request().Context(), client, token)
+}
+
+// requireRole r以上のロールを持つリクエストだけを通す
+// 主体はリクエストのコンテキストに設定し、監査ログで使う
+func requireRole(r role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, err := authenticate(c)
+			if err != nil {
+				return errStorage(err)
+			}
+			if p.Role == roleNone {
+				return errUnauthorized()
+			}
+			if p.Role < r {
+				return errForbidden()
+			}
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(withPrincipal(req.Context(), p)))
+			return next(c)
+		}
+	}
+}
+
+// createAPIToken 新しいトークンを作成して返す
+// トークンそのものは保存しないので、作成時にしか取得できない
+func createAPIToken(ctx context.Context, storeClient *firestore.Client, name string, r role) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	createdBy := ""
+	if p, ok := getPrincipal(ctx); ok {
+		createdBy = p.Name
+	}
+
+	_, err = storeClient.Collection("ApiToken").Doc(hashToken(token)).Create(ctx, apiToken{
+		Name:      name,
+		Role:      r.String(),
+		CreatedAt: time.Now(),
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// listAPITokens トークンの一覧を返す
+// IDはトークンのハッシュなので、無効にする際の指定に使う
+func listAPITokens(ctx context.Context, storeClient *firestore.Client) (map[string]apiToken, error) {
+	docs, err := storeClient.Collection("ApiToken").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	metrics.CountFirestoreReads("api_token", len(docs))
+
+	result := make(map[string]apiToken, len(docs))
+	for _, doc := range docs {
+		var t apiToken
+		err = doc.DataTo(&t)
+		if err != nil {
+			return nil, err
+		}
+		result[doc.Ref.ID] = t
+	}
+
+	return result, nil
+}
+
+func deleteAPIToken(ctx context.Context, storeClient *firestore.Client, id string) error {
+	_, err := storeClient.Collection("ApiToken").Doc(id).Delete(ctx)
+	apiTokenCache.Delete(id)
+	return err
+}
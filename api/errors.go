@@ -0,0 +1,173 @@
+// ハンドラーが返すエラーとエラーレスポンス
+// エラーはすべて{code, message}の形式で返し、原因はレスポンスに含めずログに出力する
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type httpError struct {
+	Status  int
+	Code    string
+	Message string
+	// RetryAfter 0でない場合はRetry-Afterヘッダーを付ける
+	RetryAfter time.Duration
+	// Err 原因となったエラー
+	Err error
+}
+
+func (e *httpError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v %v: %v", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%v %v: %v: %v", e.Status, e.Code, e.Message, e.Err)
+}
+
+func errBadRequest(err error) *httpError {
+	return &httpError{
+		Status:  http.StatusBadRequest,
+		Code:    "invalid_parameter",
+		Message: err.Error(),
+	}
+}
+
+func errUnauthorized() *httpError {
+	return &httpError{
+		Status:  http.StatusUnauthorized,
+		Code:    "unauthorized",
+		Message: "authentication required",
+	}
+}
+
+func errForbidden() *httpError {
+	return &httpError{
+		Status:  http.StatusForbidden,
+		Code:    "forbidden",
+		Message: "forbidden",
+	}
+}
+
+func errNotFound(message string) *httpError {
+	return &httpError{
+		Status:  http.StatusNotFound,
+		Code:    "not_found",
+		Message: message,
+	}
+}
+
+// スケジュールは1時から30分ごとに作成されるのでその間隔で再試行してもらう
+const scheduleRetryAfter = 30 * time.Minute
+
+func errScheduleNotGenerated() *httpError {
+	return &httpError{
+		Status:     http.StatusServiceUnavailable,
+		Code:       "schedule_not_generated",
+		Message:    "schedule is not generated yet",
+		RetryAfter: scheduleRetryAfter,
+	}
+}
+
+func errStorage(err error) *httpError {
+	return &httpError{
+		Status:  http.StatusInternalServerError,
+		Code:    "storage_error",
+		Message: "failed to access storage",
+		Err:     err,
+	}
+}
+
+func errJobFailed(name string, err error) *httpError {
+	return &httpError{
+		Status:  http.StatusInternalServerError,
+		Code:    name + "_failed",
+		Message: name + " job failed",
+		Err:     err,
+	}
+}
+
+func errInternal(err error) *httpError {
+	return &httpError{
+		Status:  http.StatusInternalServerError,
+		Code:    "internal",
+		Message: "internal error",
+		Err:     err,
+	}
+}
+
+// scheduleLoadError スケジュールの読み込みに失敗した場合のエラー
+// 範囲の終わりが現在以降でまだ作成されていない場合は後で再試行できるように503を返す
+func scheduleLoadError(err error, end, now time.Time) *httpError {
+	if _, ok := err.(schedule.ErrNotExists); ok {
+		if !end.Before(now) {
+			return errScheduleNotGenerated()
+		}
+		return errNotFound(err.Error())
+	}
+
+	return errStorage(err)
+}
+
+// httpErrorHandler ハンドラーが返したエラーをレスポンスにする
+func httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var e *httpError
+	switch v := err.(type) {
+	case *httpError:
+		e = v
+	case *echo.HTTPError:
+		e = &httpError{
+			Status:  v.Code,
+			Code:    "http_error",
+			Message: fmt.Sprint(v.Message),
+			Err:     v.Internal,
+		}
+		if v.Code == http.StatusNotFound {
+			e.Code = "not_found"
+		}
+	default:
+		e = errInternal(err)
+	}
+
+	ctx := c.Request().Context()
+	if e.Status >= http.StatusInternalServerError {
+		logging.Error(ctx, e.Message, logging.Fields{
+			"code":  e.Code,
+			"error": e.Err,
+		})
+	}
+
+	if e.RetryAfter > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(e.RetryAfter/time.Second)))
+	}
+
+	var werr error
+	if c.Request().Method == http.MethodHead {
+		werr = c.NoContent(e.Status)
+	} else {
+		werr = c.JSON(e.Status, apiError{
+			Code:    e.Code,
+			Message: e.Message,
+		})
+	}
+	if werr != nil {
+		logging.Error(ctx, "can not write error response", logging.Fields{
+			"error": werr,
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// 接続中のクライアントへのServer-Sent Eventsによる通知
+// schedule: スケジュールが作成、更新された
+// switch: チャンネルの番組が切り替わった
+// heartbeat: 接続の維持とサーバーの時刻の通知
+// データの形式は/api/v1と揃える
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/labstack/echo/v4"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
+)
+
+type serverEvent struct {
+	Name string
+	Data interface{}
+}
+
+type scheduleEvent struct {
+	// Date 更新されたスケジュールの日付(20060102)
+	Date string `json:"date"`
+}
+
+type heartbeatEvent struct {
+	// ServerTime RFC 3339形式のUTCの時刻
+	ServerTime string `json:"serverTime"`
+}
+
+// eventHub プロセス内でイベントを接続中のクライアントに配る
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan serverEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		clients: map[chan serverEvent]struct{}{},
+	}
+}
+
+var hub = newEventHub()
+
+func (h *eventHub) subscribe() chan serverEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan serverEvent, 16)
+	h.clients[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan serverEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, ch)
+}
+
+// broadcast 全クライアントにイベントを送る
+// 受信が追いついていないクライアントには送らない
+func (h *eventHub) broadcast(e serverEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+const heartbeatInterval = 15 * time.Second
+
+func writeServerEvent(res *echo.Response, e serverEvent) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(res, "event: %v\ndata: %s\n\n", e.Name, data)
+	if err != nil {
+		return err
+	}
+
+	res.Flush()
+	return nil
+}
+
+func newHeartbeatEvent() serverEvent {
+	return serverEvent{
+		Name: "heartbeat",
+		Data: heartbeatEvent{
+			ServerTime: formatAPITime(time.Now()),
+		},
+	}
+}
+
+func (sv *server) eventsHandler(c echo.Context) error {
+	// ストリーミングできない環境ではリクエストを保持しない
+	// EventSourceは204を受け取ると再接続しないので、クライアントは定期的な取得に切り替える
+	if !sv.opts.Events {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	ctx := c.Request().Context()
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	err := writeServerEvent(res, newHeartbeatEvent())
+	if err != nil {
+		return nil
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		var e serverEvent
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			e = newHeartbeatEvent()
+		case e = <-ch:
+		}
+
+		err := writeServerEvent(res, e)
+		if err != nil {
+			// 切断された
+			return nil
+		}
+	}
+}
+
+// watchSchedule スケジュールの変更を監視してキャッシュを破棄し、クライアントに通知する
+// 他のインスタンスでエクスポートされた場合も通知できるようにFirestoreの変更を監視する
+func watchSchedule(ctx context.Context, storeClient *firestore.Client) {
+	for {
+		// 監視するのは新しい日付のスケジュールだけで十分
+		iter := storeClient.Collection("Schedule").
+			OrderBy(firestore.DocumentID, firestore.Desc).
+			Limit(3).
+			Snapshots(ctx)
+
+		first := true
+		for {
+			snap, err := iter.Next()
+			if err != nil {
+				logging.Error(ctx, "Error watching schedule", logging.Fields{
+					"error": err,
+				})
+				break
+			}
+
+			// 最初のスナップショットは既存のドキュメントなので通知しない
+			if first {
+				first = false
+				continue
+			}
+
+			for _, change := range snap.Changes {
+				if change.Kind == firestore.DocumentRemoved {
+					continue
+				}
+
+				key := change.Doc.Ref.ID
+				schedule.Invalidate(key)
+				hub.broadcast(serverEvent{
+					Name: "schedule",
+					Data: scheduleEvent{
+						Date: key,
+					},
+				})
+			}
+		}
+		iter.Stop()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// watchChannelSwitch 番組の切り替わりを監視してクライアントに通知する
+func watchChannelSwitch(ctx context.Context, storeClient *firestore.Client, opts Options) {
+	current := map[int]string{}
+	for {
+		wait := time.Minute
+		now := time.Now()
+		s, err := schedule.LoadAround(ctx, storeClient, now, opts.Job.Schedule)
+		if err != nil {
+			logging.Error(ctx, "Error loading schedule", logging.Fields{
+				"error": err,
+			})
+		} else {
+			n := schedule.GetNow(s, now)
+			n = loadLive(ctx, storeClient, now, opts.Job.Schedule).applyNow(n)
+			for i, ch := range n.Channels {
+				if ch.Current == nil {
+					continue
+				}
+
+				if current[i] != ch.Current.VideoID {
+					current[i] = ch.Current.VideoID
+					hub.broadcast(serverEvent{
+						Name: "switch",
+						// /api/v1/nowのチャンネルと同じ形式
+						Data: toAPINowChannel(i, ch, opts),
+					})
+				}
+
+				// 次に番組が切り替わる時刻まで待つ
+				// 同時放送中の配信はいつ終わるか分からない
+				remain := ch.Current.Duration - ch.Offset
+				if remain < wait && !ch.Current.Live {
+					wait = remain
+				}
+			}
+		}
+
+		// 配信の開始と終了に気づけるようにする
+		if opts.Job.Schedule.LiveChannel >= 0 && wait > schedule.LiveCacheTTL {
+			wait = schedule.LiveCacheTTL
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// StartEventWatchers イベントの発生源となる監視を開始する
+func StartEventWatchers(ctx context.Context, opts Options) {
+	client, err := store.Shared()
+	if err != nil {
+		logging.Error(ctx, "Can't start event watchers", logging.Fields{
+			"error": err,
+		})
+		return
+	}
+
+	// スケジュールの監視はキャッシュの破棄にも使う
+	go watchSchedule(ctx, client)
+	if opts.Events {
+		go watchChannelSwitch(ctx, client, opts)
+	}
+}
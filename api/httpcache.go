@@ -0,0 +1,150 @@
+// スケジュールのレスポンスのキャッシュと条件付きリクエスト
+// スケジュールは一度作成されると変わらないため、
+// 同じ範囲のレスポンスは次に番組が切り替わるまで使いまわせる
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/yaegaki/ohohoi-bank/cache"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+// 番組の切り替わりが遠い場合でもこれ以上はキャッシュさせない
+const maxResponseCacheAge = time.Hour
+
+type cachedResponse struct {
+	body         []byte
+	etag         string
+	lastModified time.Time
+	expires      time.Time
+}
+
+// クエリパラメーターの組み合わせごとにキャッシュするので上限を設ける
+var responseCache = cache.NewBounded(1000)
+
+// どのレスポンスに含まれているかは分からないのでスケジュールが変更された場合はすべて破棄する
+func init() {
+	schedule.OnInvalidate = responseCache.Clear
+}
+
+// scheduleETag スケジュールの保存日時とレスポンスの内容から作る
+func scheduleETag(version time.Time, body []byte) string {
+	hash := sha256.Sum256(body)
+	return fmt.Sprintf(`"%x-%v"`, version.Unix(), hex.EncodeToString(hash[:8]))
+}
+
+// etagMatch If-None-Matchにetagが含まれているか
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseCacheKey パスとクエリパラメーターからキャッシュのキーを作る
+func responseCacheKey(c echo.Context) string {
+	return c.Request().URL.Path + "?" + c.QueryParams().Encode()
+}
+
+// newCachedResponse vをJSONにしてexpiresまで使いまわせるレスポンスを作る
+func newCachedResponse(v interface{}, version time.Time, expires time.Time) (cachedResponse, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return cachedResponse{}, err
+	}
+
+	return cachedResponse{
+		body:         body,
+		etag:         scheduleETag(version, body),
+		lastModified: version,
+		expires:      expires,
+	}, nil
+}
+
+// responseExpires キャッシュの期限を決める
+// 時刻が指定されている場合は時間が経っても内容は変わらない
+// 範囲の途中までしかスケジュールが作成されていない場合は次のエクスポートで変わる
+func responseExpires(s schedule.Schedule, w scheduleWindow, now, nextExport time.Time) time.Time {
+	expires := now.Add(maxResponseCacheAge)
+	if !w.Fixed {
+		next := s.NextChange(w.Start, w.Duration)
+		if !next.IsZero() && next.Before(expires) {
+			expires = next
+		}
+	}
+
+	if !nextExport.IsZero() && nextExport.Before(expires) && !coversWindow(s, w) {
+		expires = nextExport
+	}
+
+	return expires
+}
+
+// coversWindow 範囲の終わりまでスケジュールが作成されているか
+func coversWindow(s schedule.Schedule, w scheduleWindow) bool {
+	end := w.Start.Add(w.Duration)
+	for _, i := range w.Channels {
+		if i >= len(s.Channels) || s.Channels[i].FinishTime().Before(end) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getCachedResponse(key string) (cachedResponse, bool) {
+	v, ok := responseCache.Get(key)
+	if !ok {
+		return cachedResponse{}, false
+	}
+
+	return v.(cachedResponse), true
+}
+
+func setCachedResponse(key string, r cachedResponse) {
+	ttl := time.Until(r.expires)
+	if ttl <= 0 {
+		return
+	}
+
+	responseCache.Set(key, r, ttl)
+}
+
+// writeCachedResponse キャッシュ用のヘッダーを付けてレスポンスを返す
+// If-None-Matchが一致する場合は304を返す
+func writeCachedResponse(c echo.Context, r cachedResponse) error {
+	header := c.Response().Header()
+	header.Set("ETag", r.etag)
+	if !r.lastModified.IsZero() {
+		header.Set("Last-Modified", r.lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	maxAge := int(time.Until(r.expires) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%v", maxAge))
+
+	if etagMatch(c.Request().Header.Get("If-None-Match"), r.etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSONBlob(http.StatusOK, r.body)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+func TestResponseExpires(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time {
+		return now.Add(time.Duration(minute) * time.Minute)
+	}
+	// 2チャンネルとも12:00から1本目が20分、2本目がuntilまで
+	newSchedule := func(until int) schedule.Schedule {
+		var s schedule.Schedule
+		for i := 0; i < 2; i++ {
+			s.Channels = append(s.Channels, schedule.Channel{Items: []schedule.Item{
+				{Time: at(0), Duration: 20 * time.Minute, VideoID: "a"},
+				{Time: at(20), Duration: time.Duration(until-20) * time.Minute, VideoID: "b"},
+			}})
+		}
+		return s
+	}
+	window := func(fixed bool) scheduleWindow {
+		return scheduleWindow{Start: now, Duration: time.Hour, Channels: []int{0, 1}, Fixed: fixed}
+	}
+
+	tests := []struct {
+		name       string
+		s          schedule.Schedule
+		w          scheduleWindow
+		nextExport time.Time
+		want       time.Time
+	}{
+		{"until the next change", newSchedule(300), window(false), at(600), at(20)},
+		{"fixed window", newSchedule(300), window(true), at(600), at(60)},
+		// 範囲の途中までしか作成されていない場合は次のエクスポートで変わる
+		{"partial window", newSchedule(45), window(true), at(30), at(30)},
+		{"partial window before the next change", newSchedule(45), window(false), at(10), at(10)},
+		{"export after the limit", newSchedule(45), window(true), at(600), at(60)},
+		{"covered window", newSchedule(300), window(true), at(30), at(60)},
+		{"unknown next export", newSchedule(45), window(true), time.Time{}, at(60)},
+	}
+
+	for _, tt := range tests {
+		got := responseExpires(tt.s, tt.w, now, tt.nextExport)
+		if !got.Equal(tt.want) {
+			t.Errorf("%v: responseExpires = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// ライブ配信の同時放送をレスポンスに反映する
+package api
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+// liveState 配信中のライブ
+type liveState struct {
+	live schedule.Live
+	// channel 配信に差し替えるチャンネル(0から)
+	channel int
+	ok      bool
+}
+
+// loadLive 配信の状態を読み込めない場合は同時放送していないものとして扱う
+// 同時放送のためにスケジュールを返せなくなることがないようにする
+func loadLive(ctx context.Context, storeClient *firestore.Client, now time.Time, opts schedule.Options) liveState {
+	l, ok, err := schedule.GetLive(ctx, storeClient, now, opts)
+	if err != nil {
+		logging.Warning(ctx, "Error loading live", logging.Fields{
+			"error": err,
+		})
+		return liveState{}
+	}
+	return liveState{live: l, channel: opts.LiveChannel, ok: ok}
+}
+
+// cacheKey 配信の開始と終了でレスポンスが変わるのでキャッシュのキーに含める
+func (l liveState) cacheKey(key string) string {
+	if !l.ok {
+		return key
+	}
+	return key + "#live=" + l.live.VideoID
+}
+
+// applySchedule 現在を含む範囲であれば配信を同時放送の番組として入れる
+// 配信はいつ終わるか分からないのでキャッシュの期限を短くする
+func (l liveState) applySchedule(s schedule.Schedule, w scheduleWindow, now, expires time.Time) (schedule.Schedule, time.Time) {
+	if !l.ok || w.Start.After(now) {
+		return s, expires
+	}
+
+	s = s.WithLive(l.live, l.channel, w.Start.Add(w.Duration))
+	if limit := now.Add(schedule.LiveCacheTTL); expires.After(limit) {
+		expires = limit
+	}
+	return s, expires
+}
+
+func (l liveState) applyNow(n schedule.Now) schedule.Now {
+	if !l.ok {
+		return n
+	}
+	return n.WithLive(l.live, l.channel)
+}
@@ -0,0 +1,69 @@
+// アクセスログとメトリクス
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// requestLogger リクエストIDをコンテキストに設定してアクセスログを出力する
+// X-Request-IDが指定されていない場合は新しく作成する
+func requestLogger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if id == "" {
+			id = logging.NewID()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		ctx := logging.WithRequestID(req.Context(), id)
+		c.SetRequest(req.WithContext(ctx))
+
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+
+		logging.Info(ctx, "request", logging.Fields{
+			"method":    req.Method,
+			"path":      req.URL.Path,
+			"status":    c.Response().Status,
+			"latencyMs": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+
+		return nil
+	}
+}
+
+// metricsMiddleware ハンドラーごとのリクエスト数と処理時間を記録する
+// パスではなくルートで集計するのでラベルの種類は増えない
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+
+		route := c.Path()
+		method := c.Request().Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().Status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+		return nil
+	}
+}
+
+// metricsHandler Prometheusの形式でメトリクスを返す
+// 内部の状態が分かるのでviewer以上のトークンを持つリクエストにだけ返す
+// Prometheusからはscrape_configsのauthorizationでトークンを指定する
+func metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
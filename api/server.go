@@ -0,0 +1,204 @@
+// 公開用と管理用のHTTPサーバー
+package api
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/config"
+	"github.com/yaegaki/ohohoi-bank/job"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
+)
+
+// Options 設定ファイルから作成してNewServerに渡す
+type Options struct {
+	Job job.Options
+	// ChannelNames チャンネルごとの表示名
+	ChannelNames []string
+	// DefaultWindow /scheduleでdurationを省略した場合の長さ
+	DefaultWindow time.Duration
+	// MaxWindow 1回で読み込むスケジュールが多くなりすぎないように制限する
+	MaxWindow time.Duration
+	// Config 管理用APIで返す読み込んだ設定
+	Config config.Config
+	// Events /eventsでServer-Sent Eventsを配信する、無効の場合は204を返す
+	Events bool
+}
+
+// server 設定が必要なハンドラーを持つ
+type server struct {
+	opts Options
+}
+
+// scheduleResponse 時刻はUTCで返し、放送のタイムゾーンはZoneで別に返す
+type scheduleResponse struct {
+	Zone     string
+	Channels []scheduleChannelResponse
+}
+
+// writeScheduleResponse at, duration, channelsで指定された範囲のスケジュールを読み込み、shapeで作ったレスポンスを返す
+// レスポンスは次に番組が切り替わるまでキャッシュして、/scheduleと/api/v1/scheduleで形式だけを変える
+func (sv *server) writeScheduleResponse(c echo.Context, shape func(s schedule.Schedule, w scheduleWindow) interface{}) error {
+	ctx := c.Request().Context()
+
+	now := time.Now()
+	client, err := store.Shared()
+	if err != nil {
+		return errStorage(err)
+	}
+	live := loadLive(ctx, client, now, sv.opts.Job.Schedule)
+
+	key := live.cacheKey(responseCacheKey(c))
+	if r, ok := getCachedResponse(key); ok {
+		return writeCachedResponse(c, r)
+	}
+
+	w, err := parseScheduleWindow(c.QueryParams(), now, sv.opts)
+	if err != nil {
+		return errBadRequest(err)
+	}
+
+	end := w.Start.Add(w.Duration)
+	s, err := schedule.LoadRange(ctx, client, w.Start, end, sv.opts.Job.Schedule)
+	if err != nil {
+		return scheduleLoadError(err, end, now)
+	}
+
+	expires := responseExpires(s, w, now, sv.opts.Job.NextExport(now))
+	s, expires = live.applySchedule(s, w, now, expires)
+	s = s.Part(w.Start, w.Duration)
+	r, err := newCachedResponse(shape(s, w), s.UpdatedAt, expires)
+	if err != nil {
+		return err
+	}
+
+	setCachedResponse(key, r)
+	return writeCachedResponse(c, r)
+}
+
+// loadNow 現在再生中の番組を配信の同時放送を反映して返す
+func (sv *server) loadNow(c echo.Context) (schedule.Now, error) {
+	ctx := c.Request().Context()
+
+	now := time.Now()
+	client, err := store.Shared()
+	if err != nil {
+		return schedule.Now{}, errStorage(err)
+	}
+	s, err := schedule.LoadAround(ctx, client, now, sv.opts.Job.Schedule)
+	if err != nil {
+		return schedule.Now{}, scheduleLoadError(err, now, now)
+	}
+	live := loadLive(ctx, client, now, sv.opts.Job.Schedule)
+
+	return live.applyNow(schedule.GetNow(s, now)), nil
+}
+
+// scheduleHandler at, duration, channelsで指定された範囲のスケジュールを返す
+func (sv *server) scheduleHandler(c echo.Context) error {
+	return sv.writeScheduleResponse(c, func(s schedule.Schedule, w scheduleWindow) interface{} {
+		return scheduleResponse{
+			Zone:     broadcast.Location.String(),
+			Channels: selectChannels(s.UTC(), w.Channels),
+		}
+	})
+}
+
+// nowHandler 内部の構造体をそのまま返す古い形式
+// Deprecated: /api/v1/nowを使う、このエンドポイントは互換性のために残している
+func (sv *server) nowHandler(c echo.Context) error {
+	n, err := sv.loadNow(c)
+	if err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set("Deprecation", "true")
+	header.Set("Link", `</api/v1/now>; rel="successor-version"`)
+	return c.JSON(http.StatusOK, n)
+}
+
+// onAppEngine App Engineで動いている場合だけ設定される環境変数で判定する
+func onAppEngine() bool {
+	return os.Getenv("GAE_ENV") != "" || os.Getenv("GAE_APPLICATION") != ""
+}
+
+// isAppEngineCron App Engineのcronからのリクエストか
+// X-Appengine-CronはApp Engineでは外部から付けても取り除かれるが、それ以外では付けられるのでApp Engineで動いている場合だけ信用する
+func (sv *server) isAppEngineCron(c echo.Context) bool {
+	return sv.opts.Job.Scheduler == job.SchedulerAppEngine && onAppEngine() && c.Request().Header.Get("X-Appengine-Cron") == "true"
+}
+
+// taskHandler App Engineのcronのリクエストか、editor以上のトークンを持つPOSTのリクエストからジョブを実行する
+// cronはGETで呼び出すので、GETはcronからのリクエストだけを受け付ける
+func (sv *server) taskHandler(name string, run func(ctx context.Context, opts job.Options) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		isCron := c.Request().Method == http.MethodGet && sv.isAppEngineCron(c)
+
+		if !isCron {
+			if c.Request().Method != http.MethodPost {
+				return &httpError{
+					Status:  http.StatusMethodNotAllowed,
+					Code:    "method_not_allowed",
+					Message: "use POST with an API token",
+				}
+			}
+
+			p, err := authenticate(c)
+			if err != nil {
+				return errStorage(err)
+			}
+			if p.Role == roleNone {
+				return errUnauthorized()
+			}
+			if p.Role < roleEditor {
+				return errForbidden()
+			}
+
+			ctx = withPrincipal(ctx, p)
+		}
+
+		err := run(ctx, sv.opts.Job)
+		// cron以外から実行した場合は結果を監査ログに記録する
+		// ジョブは実行済みなのでクライアントを取得できなくてもジョブの結果を返す
+		if client, serr := store.Shared(); !isCron && serr == nil {
+			writeAudit(ctx, client, "job."+name, name, jobAuditDetail(err))
+		}
+		if err != nil {
+			return errJobFailed(name, err)
+		}
+
+		return c.String(http.StatusOK, "done.")
+	}
+}
+
+// NewServer ルーティングを設定したサーバーを作成する
+func NewServer(opts Options) *echo.Echo {
+	sv := &server{opts: opts}
+	e := echo.New()
+	e.HideBanner = true
+	e.HTTPErrorHandler = httpErrorHandler
+	e.Use(requestLogger)
+	e.Use(metricsMiddleware)
+	e.GET("/schedule", sv.scheduleHandler)
+	e.GET("/now", sv.nowHandler)
+	e.GET("/events", sv.eventsHandler)
+	sv.registerAPIv1(e)
+	sv.registerAdmin(e)
+	exportTask := sv.taskHandler("export", job.RunExport)
+	e.GET("/_task/export", exportTask)
+	e.POST("/_task/export", exportTask)
+	liveTask := sv.taskHandler("live", job.PollLive)
+	e.GET("/_task/live", liveTask)
+	e.POST("/_task/live", liveTask)
+	e.GET("/metrics", metricsHandler(), requireRole(roleViewer))
+	e.Static("/", "public")
+	return e
+}
@@ -0,0 +1,112 @@
+// スケジュールを取得する範囲の指定
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+// scheduleWindow Startから Duration分の指定されたチャンネルのスケジュール
+type scheduleWindow struct {
+	Start    time.Time
+	Duration time.Duration
+	// Channels 0から始まるチャンネルの番号
+	Channels []int
+	// Fixed atで開始時刻が指定された、省略された場合は開始時刻がリクエストごとに変わる
+	Fixed bool
+}
+
+type errInvalidParameter struct {
+	Name   string
+	Value  string
+	Reason string
+}
+
+func (e errInvalidParameter) Error() string {
+	return fmt.Sprintf("invalid %v %q: %v", e.Name, e.Value, e.Reason)
+}
+
+// parseScheduleWindow クエリパラメーターから範囲を取得する
+// at: 開始時刻(RFC3339)、省略時はnow
+// duration: 長さ(1h30mなど)、省略時はopts.DefaultWindow
+// channels: 1から始まるチャンネルの番号をカンマ区切りで指定、省略時はすべて
+func parseScheduleWindow(query url.Values, now time.Time, opts Options) (scheduleWindow, error) {
+	w := scheduleWindow{
+		Start:    now,
+		Duration: opts.DefaultWindow,
+	}
+	channelCount := opts.Job.Schedule.ChannelCount
+
+	if at := query.Get("at"); at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return scheduleWindow{}, errInvalidParameter{"at", at, "must be RFC 3339"}
+		}
+		w.Start = t
+		w.Fixed = true
+	}
+
+	if duration := query.Get("duration"); duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return scheduleWindow{}, errInvalidParameter{"duration", duration, "must be a duration such as 3h"}
+		}
+		if d <= 0 || d > opts.MaxWindow {
+			return scheduleWindow{}, errInvalidParameter{"duration", duration, fmt.Sprintf("must be greater than 0 and at most %v", opts.MaxWindow)}
+		}
+		w.Duration = d
+	}
+
+	channels := query.Get("channels")
+	if channels == "" {
+		for i := 0; i < channelCount; i++ {
+			w.Channels = append(w.Channels, i)
+		}
+		return w, nil
+	}
+
+	selected := map[int]struct{}{}
+	for _, v := range strings.Split(channels, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 || n > channelCount {
+			return scheduleWindow{}, errInvalidParameter{"channels", channels, fmt.Sprintf("must be numbers between 1 and %v", channelCount)}
+		}
+
+		_, ok := selected[n-1]
+		if ok {
+			continue
+		}
+		selected[n-1] = struct{}{}
+		w.Channels = append(w.Channels, n-1)
+	}
+
+	return w, nil
+}
+
+type scheduleChannelResponse struct {
+	// Number 1から始まるチャンネルの番号
+	Number int
+	Items  []schedule.Item
+}
+
+// selectChannels 指定されたチャンネルだけを取り出す
+func selectChannels(s schedule.Schedule, channels []int) []scheduleChannelResponse {
+	result := make([]scheduleChannelResponse, 0, len(channels))
+	for _, i := range channels {
+		if i >= len(s.Channels) {
+			continue
+		}
+
+		result = append(result, scheduleChannelResponse{
+			Number: i + 1,
+			Items:  s.Channels[i].Items,
+		})
+	}
+
+	return result
+}
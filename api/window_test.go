@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+func testWindowOptions() Options {
+	opts := Options{
+		DefaultWindow: 3 * time.Hour,
+		MaxWindow:     48 * time.Hour,
+	}
+	opts.Job.Schedule = schedule.DefaultOptions()
+	opts.Job.Schedule.ChannelCount = 3
+	return opts
+}
+
+func TestParseScheduleWindow(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	opts := testWindowOptions()
+
+	tests := []struct {
+		name  string
+		query string
+		want  scheduleWindow
+	}{
+		{
+			name: "default",
+			want: scheduleWindow{Start: now, Duration: 3 * time.Hour, Channels: []int{0, 1, 2}},
+		},
+		{
+			name:  "at",
+			query: "at=2020-01-02T09:00:00%2B09:00",
+			want:  scheduleWindow{Start: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), Duration: 3 * time.Hour, Channels: []int{0, 1, 2}, Fixed: true},
+		},
+		{
+			name:  "duration",
+			query: "duration=1h30m",
+			want:  scheduleWindow{Start: now, Duration: 90 * time.Minute, Channels: []int{0, 1, 2}},
+		},
+		{
+			name:  "max duration",
+			query: "duration=48h",
+			want:  scheduleWindow{Start: now, Duration: 48 * time.Hour, Channels: []int{0, 1, 2}},
+		},
+		{
+			name:  "channels",
+			query: "channels=3,%201,3",
+			want:  scheduleWindow{Start: now, Duration: 3 * time.Hour, Channels: []int{2, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+
+		got, err := parseScheduleWindow(query, now, opts)
+		if err != nil {
+			t.Errorf("%v: parseScheduleWindow returned error: %v", tt.name, err)
+			continue
+		}
+		if !got.Start.Equal(tt.want.Start) || got.Duration != tt.want.Duration || !reflect.DeepEqual(got.Channels, tt.want.Channels) || got.Fixed != tt.want.Fixed {
+			t.Errorf("%v: parseScheduleWindow = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleWindowInvalid(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	opts := testWindowOptions()
+
+	tests := []struct {
+		query string
+		name  string
+	}{
+		{"at=2020-01-02", "at"},
+		{"at=tomorrow", "at"},
+		{"duration=3", "duration"},
+		{"duration=0s", "duration"},
+		{"duration=-1h", "duration"},
+		{"duration=49h", "duration"},
+		{"channels=0", "channels"},
+		{"channels=4", "channels"},
+		{"channels=1,,2", "channels"},
+		{"channels=a", "channels"},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.query, err)
+		}
+
+		_, err = parseScheduleWindow(query, now, opts)
+		e, ok := err.(errInvalidParameter)
+		if !ok {
+			t.Errorf("%v: parseScheduleWindow returned %v, want errInvalidParameter", tt.query, err)
+			continue
+		}
+		if e.Name != tt.name {
+			t.Errorf("%v: invalid parameter %v, want %v", tt.query, e.Name, tt.name)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+// setDay タイムゾーンと放送日の区切りを変更して、元に戻す関数を返す
+func setDay(t *testing.T, name string, offset time.Duration) func() {
+	loc, err := LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %v is not available: %v", name, err)
+	}
+
+	prevLocation, prevOffset := Location, DayStartOffset
+	Location, DayStartOffset = loc, offset
+	return func() {
+		Location, DayStartOffset = prevLocation, prevOffset
+	}
+}
+
+func TestDayStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		offset   time.Duration
+		t        string
+		want     string
+	}{
+		{"midnight", "Asia/Tokyo", 0, "2020-01-02T00:00:00+09:00", "2020-01-02T00:00:00+09:00"},
+		{"end of the day", "Asia/Tokyo", 0, "2020-01-02T23:59:59+09:00", "2020-01-02T00:00:00+09:00"},
+		{"other timezone", "Asia/Tokyo", 0, "2020-01-01T15:00:00Z", "2020-01-02T00:00:00+09:00"},
+		// 放送日の区切りより前は前日の放送日
+		{"before the day start", "Asia/Tokyo", 5 * time.Hour, "2020-01-02T04:59:59+09:00", "2020-01-01T05:00:00+09:00"},
+		{"at the day start", "Asia/Tokyo", 5 * time.Hour, "2020-01-02T05:00:00+09:00", "2020-01-02T05:00:00+09:00"},
+		{"before the first day of the month", "Asia/Tokyo", 5 * time.Hour, "2020-03-01T01:00:00+09:00", "2020-02-29T05:00:00+09:00"},
+		// 夏時間の切り替えの日
+		{"daylight saving starts", "America/New_York", 5 * time.Hour, "2020-03-08T12:00:00-04:00", "2020-03-08T05:00:00-04:00"},
+		{"before daylight saving starts", "America/New_York", 5 * time.Hour, "2020-03-08T01:00:00-05:00", "2020-03-07T05:00:00-05:00"},
+		{"daylight saving ends", "America/New_York", 5 * time.Hour, "2020-11-01T12:00:00-05:00", "2020-11-01T05:00:00-05:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setDay(t, tt.timezone, tt.offset)()
+			at, err := time.Parse(time.RFC3339, tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := time.Parse(time.RFC3339, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := DayStart(at)
+			if !got.Equal(want) {
+				t.Errorf("DayStart(%v) = %v, want %v", tt.t, got, want)
+			}
+			if got.Location() != Location {
+				t.Errorf("DayStart(%v) location = %v, want %v", tt.t, got.Location(), Location)
+			}
+		})
+	}
+}
+
+func TestNextDay(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		offset   time.Duration
+		day      string
+		want     string
+		length   time.Duration
+	}{
+		{"normal day", "Asia/Tokyo", 0, "2020-01-01", "2020-01-02", 24 * time.Hour},
+		{"end of the year", "Asia/Tokyo", 5 * time.Hour, "2020-12-31", "2021-01-01", 24 * time.Hour},
+		// 夏時間の切り替えがある放送日は24時間ではない
+		{"daylight saving starts", "America/New_York", 5 * time.Hour, "2020-03-07", "2020-03-08", 23 * time.Hour},
+		{"daylight saving ends", "America/New_York", 5 * time.Hour, "2020-10-31", "2020-11-01", 25 * time.Hour},
+		{"after daylight saving starts", "America/New_York", 5 * time.Hour, "2020-03-08", "2020-03-09", 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setDay(t, tt.timezone, tt.offset)()
+			day, err := ParseKey(tt.day)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := NextDay(day)
+			if got := Key(next); got != tt.want {
+				t.Errorf("NextDay(%v) = %v, want %v", tt.day, got, tt.want)
+			}
+			if got := next.Sub(day); got != tt.length {
+				t.Errorf("length of %v = %v, want %v", tt.day, got, tt.length)
+			}
+			// 放送日の途中からでも次の放送日の開始時刻
+			if got := NextDay(day.Add(tt.length - time.Second)); !got.Equal(next) {
+				t.Errorf("NextDay(end of %v) = %v, want %v", tt.day, got, next)
+			}
+			if got := PrevDay(next); !got.Equal(day) {
+				t.Errorf("PrevDay(%v) = %v, want %v", tt.want, got, day)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	defer setDay(t, "Asia/Tokyo", 5*time.Hour)()
+
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2020, 1, 2, 5, 0, 0, 0, Location), "2020-01-02"},
+		// 区切りより前は前日の放送日
+		{time.Date(2020, 1, 2, 4, 59, 0, 0, Location), "2020-01-01"},
+		{time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC), "2020-01-02"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.t); got != tt.want {
+			t.Errorf("Key(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, timezone := range []string{"Asia/Tokyo", "America/New_York"} {
+		t.Run(timezone, func(t *testing.T) {
+			defer setDay(t, timezone, 5*time.Hour)()
+
+			// 夏時間の切り替えの日も同じ日付に戻る
+			for _, key := range []string{"2020-01-01", "2020-02-29", "2020-03-08", "2020-11-01", "2020-12-31"} {
+				day, err := ParseKey(key)
+				if err != nil {
+					t.Errorf("ParseKey(%q) returned error: %v", key, err)
+					continue
+				}
+				if !day.Equal(DayStart(day)) {
+					t.Errorf("ParseKey(%q) = %v, want the day start", key, day)
+				}
+				if got := Key(day); got != key {
+					t.Errorf("Key(ParseKey(%q)) = %v", key, got)
+				}
+			}
+		})
+	}
+
+	invalid := []string{"", "2020-1-1", "2020/01/01", "20200101", "2020-02-30", "2020-13-01", "2020-01-01T00:00:00Z", "today"}
+	for _, value := range invalid {
+		if _, err := ParseKey(value); err == nil {
+			t.Errorf("ParseKey(%q) should return error", value)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// 放送日の区切りとタイムゾーン
+// 設定ファイルのscheduling.timezone(SIRO4_TIMEZONE)とscheduling.dayStart(SIRO4_DAY_START)で変更する
+package broadcast
+
+import (
+	"fmt"
+	"time"
+)
+
+const DefaultTimezone = "Asia/Tokyo"
+
+var (
+	Location *time.Location
+	// DayStartOffset 0時から放送日が切り替わるまでの時間
+	DayStartOffset time.Duration
+)
+
+// 設定を読み込むまではデフォルトのタイムゾーンを使う
+func init() {
+	Location, _ = LoadLocation(DefaultTimezone)
+}
+
+// LoadLocation nameのタイムゾーンを読み込む
+func LoadLocation(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err == nil {
+		return loc, nil
+	}
+
+	// タイムゾーンのデータベースがない環境でもデフォルトのタイムゾーンでは動くようにする
+	if name == DefaultTimezone {
+		return time.FixedZone(DefaultTimezone, 9*60*60), nil
+	}
+
+	return nil, err
+}
+
+// ParseDayStart HH:MM形式の時刻を0時からの時間にする
+func ParseDayStart(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// DayAt 指定された日付の放送日の開始時刻
+// 夏時間の切り替えがあっても日付の計算はtime.Dateに任せるので1日が24時間でなくてもよい
+func DayAt(year int, month time.Month, day int) time.Time {
+	hour := int(DayStartOffset / time.Hour)
+	minute := int(DayStartOffset % time.Hour / time.Minute)
+	return time.Date(year, month, day, hour, minute, 0, 0, Location)
+}
+
+// DayStart tを含む放送日の開始時刻
+func DayStart(t time.Time) time.Time {
+	t = t.In(Location)
+	start := DayAt(t.Year(), t.Month(), t.Day())
+	if t.Before(start) {
+		start = DayAt(t.Year(), t.Month(), t.Day()-1)
+	}
+
+	return start
+}
+
+// NextDay 次の放送日の開始時刻
+func NextDay(t time.Time) time.Time {
+	t = DayStart(t)
+	return DayAt(t.Year(), t.Month(), t.Day()+1)
+}
+
+// PrevDay 前の放送日の開始時刻
+func PrevDay(t time.Time) time.Time {
+	t = DayStart(t)
+	return DayAt(t.Year(), t.Month(), t.Day()-1)
+}
+
+// Today 今日の放送日の開始時刻を返す
+func Today() time.Time {
+	return DayStart(time.Now())
+}
+
+// Key 放送日のドキュメントのID(YYYY-MM-DD)
+func Key(t time.Time) string {
+	return DayStart(t).Format("2006-01-02")
+}
+
+// ParseKey YYYY-MM-DD形式の日付を放送日の開始時刻にする
+func ParseKey(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: %v", value, err)
+	}
+
+	return DayAt(t.Year(), t.Month(), t.Day()), nil
+}
@@ -0,0 +1,92 @@
+// プロセス内で共有するTTL付きのキャッシュ
+// Firestoreのドキュメントの読み込みを減らす
+// 複数インスタンスで動いている場合、他のインスタンスでの書き込みはTTLが切れるまで反映されない
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// TTLCache 値ごとに有効期限を持つキャッシュ
+// 複数のgoroutineから使える
+type TTLCache struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	// maxEntries 保持するエントリの上限、0の場合は上限なし
+	maxEntries int
+}
+
+// New 上限のないキャッシュを作成する
+func New() *TTLCache {
+	return NewBounded(0)
+}
+
+// NewBounded キーの種類が際限なく増える可能性がある場合に使う
+func NewBounded(maxEntries int) *TTLCache {
+	return &TTLCache{
+		entries:    map[string]entry{},
+		maxEntries: maxEntries,
+	}
+}
+
+// Get 期限内の値を返す
+func (c *TTLCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+func (c *TTLCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		// 期限切れのものを消しても足りない場合はすべて破棄する
+		if len(c.entries) >= c.maxEntries {
+			c.entries = map[string]entry{}
+		}
+	}
+
+	c.entries[key] = entry{
+		value:   value,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+func (c *TTLCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *TTLCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]entry{}
+}
@@ -0,0 +1,538 @@
+// コマンドラインから実行する運用向けのコマンド
+// サーバーと同じバイナリを引数付きで実行する(go build -o siro4 .)
+// -emulatorを指定するとFirestoreエミュレーターに対して実行する
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/api"
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/job"
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
+	"github.com/yaegaki/ohohoi-bank/youtube"
+)
+
+const commandUsage = `usage: siro4 [-config FILE] [-emulator HOST:PORT] [-project ID] <command>
+  export
+      YouTubeから新しい動画とソースのプレイリストを取得する
+  schedule generate [-date YYYY-MM-DD] [-force]
+      スケジュールを作成する(省略時は明日、-forceを付けると作成済みでも作り直す、作り直せるのは明日以降の最後の日付だけ)
+  schedule show [-date YYYY-MM-DD] [-channel N]
+      スケジュールを表示する(省略時は今日のすべてのチャンネル)
+  schedule validate [-date YYYY-MM-DD]
+      スケジュールを検査して統計を表示する(省略時は今日)
+  library list [-offset N] [-limit N]
+      動画をNumber順に表示する
+  library search <query>
+      タイトルに含まれる文字列で動画を検索する
+  library check
+      Videoコレクションの連番を検査する
+  library series [-rebuild]
+      タイトルから見つけたシリーズとカーソルを表示する(-rebuildを付けると見つけ直す)
+  library renumber [-by-published] [-apply]
+      Numberを0からの連番に振り直す(-applyを付けない場合は変更点の表示のみ)`
+
+// Run サブコマンドを実行して終了コードを返す
+// setupはフラグを解析した後に設定ファイルのパスを渡して呼び出し、コマンドで使う設定を返す
+func Run(args []string, setup func(path string) (api.Options, error)) int {
+	fs := flag.NewFlagSet("siro4", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, commandUsage)
+	}
+	configPath := fs.String("config", "", "設定ファイル")
+	emulator := fs.String("emulator", "", "Firestoreエミュレーターのホスト")
+	project := fs.String("project", "", "FirestoreのプロジェクトID")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	args = fs.Args()
+
+	// 設定ファイルより優先するので環境変数で渡す
+	if *emulator != "" {
+		os.Setenv("FIRESTORE_EMULATOR_HOST", *emulator)
+	}
+	if *project != "" {
+		os.Setenv("SIRO4_PROJECT", *project)
+	}
+	opts, err := setup(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+	name := args[0]
+	rest := args[1:]
+	if name != "export" && len(args) >= 2 {
+		name += " " + args[1]
+		rest = args[2:]
+	}
+
+	ctx := context.Background()
+	switch name {
+	case "export":
+		err = exportCommand(ctx, opts.Job)
+	case "schedule generate":
+		err = scheduleGenerateCommand(ctx, rest, opts.Job.Schedule)
+	case "schedule show":
+		err = scheduleShowCommand(ctx, rest, opts)
+	case "schedule validate":
+		err = scheduleValidateCommand(ctx, rest, opts.Job.Schedule)
+	case "library list":
+		err = libraryListCommand(ctx, rest)
+	case "library search":
+		err = librarySearchCommand(ctx, rest)
+	case "library check":
+		err = libraryCheckCommand(ctx)
+	case "library renumber":
+		err = libraryRenumberCommand(ctx, rest)
+	case "library series":
+		err = librarySeriesCommand(ctx, rest)
+	default:
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// parseDateFlag YYYY-MM-DD形式の日付を解釈する
+// 空の場合は今日を返す
+func parseDateFlag(value string) (time.Time, error) {
+	if value == "" {
+		return broadcast.Today(), nil
+	}
+
+	return broadcast.ParseKey(value)
+}
+
+func scheduleValidateCommand(ctx context.Context, args []string, opts schedule.Options) error {
+	fs := flag.NewFlagSet("schedule validate", flag.ContinueOnError)
+	date := fs.String("date", "", "検査する日付(YYYY-MM-DD)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	day, err := parseDateFlag(*date)
+	if err != nil {
+		return err
+	}
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	s, err := schedule.Get(ctx, client, day, opts)
+	if err != nil {
+		return err
+	}
+
+	var prevSchedule *schedule.Schedule
+	prev, err := schedule.Get(ctx, client, broadcast.PrevDay(day), opts)
+	if err == nil {
+		prevSchedule = &prev
+	} else if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	// スケジュールを作成したときと同じくプレイリストの動画も候補に含める
+	idx, _, err := schedule.LoadCandidates(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+
+	report := schedule.Validate(s, prevSchedule, day, idx, opts)
+	fmt.Printf("date: %v\n", broadcast.Key(report.Date))
+	fmt.Printf("items: %v\n", report.Stats.ItemCount)
+	fmt.Printf("unique videos: %v (diversity %.2f)\n", report.Stats.UniqueVideos, report.Stats.Diversity)
+	fmt.Printf("average age: %.1f days\n", report.Stats.AverageAge.Hours()/24)
+	fmt.Println("durations:")
+	var min time.Duration
+	for _, b := range report.Stats.DurationHistogram {
+		if b.Max == 0 {
+			fmt.Printf("  %v-: %v\n", min, b.Count)
+		} else {
+			fmt.Printf("  %v-%v: %v\n", min, b.Max, b.Count)
+		}
+		min = b.Max
+	}
+	for _, issue := range report.Issues {
+		fmt.Println(issue)
+	}
+
+	if report.HasError() {
+		return fmt.Errorf("%v issues found", len(report.Issues))
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func libraryCheckCommand(ctx context.Context) error {
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	videos, statistics, err := library.Load(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	report := library.Check(videos, statistics.VideoCount)
+	fmt.Printf("VideoCount: %v, documents: %v\n", report.VideoCount, report.DocumentCount)
+	for _, issue := range report.Issues {
+		fmt.Println(issue)
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("%v issues found", len(report.Issues))
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func libraryRenumberCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("library renumber", flag.ContinueOnError)
+	byPublishedAt := fs.Bool("by-published", false, "公開日時の順番で振り直す")
+	apply := fs.Bool("apply", false, "変更を書き込む")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// 書き込む場合は計画を作成する前にyoutube.ExportVideosと同じロックを取得しておく
+	var lock *lease.Lock
+	if *apply {
+		lock, err = lease.AcquireLock(ctx, client, "export-video", lease.ExportTTL)
+		if err != nil {
+			return err
+		}
+		defer lock.Release(ctx)
+	}
+
+	videos, statistics, err := library.Load(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	changes := library.PlanRenumber(videos, *byPublishedAt)
+	for _, c := range changes {
+		fmt.Printf("%v: %v -> %v %v\n", c.DocID, c.From, c.To, c.Title)
+	}
+	if statistics.VideoCount != len(videos) {
+		fmt.Printf("VideoCount: %v -> %v\n", statistics.VideoCount, len(videos))
+	}
+
+	if !*apply {
+		fmt.Printf("%v changes (dry-run)\n", len(changes))
+		return nil
+	}
+
+	err = library.ApplyRenumber(ctx, lock, client, changes, statistics.VideoCount, len(videos))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v changes applied\n", len(changes))
+	return nil
+}
+
+func exportCommand(ctx context.Context, opts job.Options) error {
+	ctx = logging.WithJobRunID(ctx, logging.NewID())
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	service, err := youtube.NewService(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = youtube.ExportVideos(ctx, service, client, opts.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	return youtube.ExportPlaylists(ctx, service, client, opts.Schedule.PlaylistIDs)
+}
+
+// scheduleGenerateCommand 前日のスケジュールから続くようにdateのスケジュールを作成する
+func scheduleGenerateCommand(ctx context.Context, args []string, opts schedule.Options) error {
+	fs := flag.NewFlagSet("schedule generate", flag.ContinueOnError)
+	date := fs.String("date", "", "作成する日付(YYYY-MM-DD)")
+	force := fs.Bool("force", false, "作成済みでも作り直す(明日以降の最後の日付だけ)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	day := broadcast.NextDay(broadcast.Today())
+	if *date != "" {
+		day, err = broadcast.ParseKey(*date)
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	lock, err := lease.AcquireLock(ctx, client, "export-schedule", lease.ExportTTL)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	_, err = schedule.Get(ctx, client, day, opts)
+	if err == nil {
+		if !*force {
+			return fmt.Errorf("schedule for %v already exists (use -force to regenerate)", broadcast.Key(day))
+		}
+
+		// 放送中や放送済みのスケジュールと、後の日付が続いているスケジュールは作り直さない
+		if !day.After(broadcast.Today()) {
+			return fmt.Errorf("schedule for %v is already on air, only schedules after today can be regenerated", broadcast.Key(day))
+		}
+		err = schedule.CheckLatest(ctx, client, day)
+		if e, ok := err.(schedule.ErrLaterSchedule); ok {
+			return fmt.Errorf("schedule %v depends on %v, delete it first", e.Date, broadcast.Key(day))
+		}
+		if err != nil {
+			return err
+		}
+
+		// 削除してシリーズのカーソルをこの日の作成前に戻してから作り直す
+		err = schedule.Delete(ctx, client, day)
+		if err != nil {
+			return err
+		}
+	} else if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	var prevSchedule *schedule.Schedule
+	prev, err := schedule.Get(ctx, client, broadcast.PrevDay(day), opts)
+	if err == nil {
+		prevSchedule = &prev
+	} else if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	source, err := schedule.NewVideoSource(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+
+	s, err := schedule.Create(ctx, source, prevSchedule, day)
+	if err != nil {
+		return err
+	}
+	report := schedule.Validate(s, prevSchedule, day, source.Index(), opts)
+	for _, issue := range report.Issues {
+		fmt.Println(issue)
+	}
+
+	err = schedule.Save(ctx, client, lock, day, s, report)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("schedule for %v generated (%v items)\n", broadcast.Key(day), report.Stats.ItemCount)
+	return nil
+}
+
+func scheduleShowCommand(ctx context.Context, args []string, opts api.Options) error {
+	fs := flag.NewFlagSet("schedule show", flag.ContinueOnError)
+	date := fs.String("date", "", "表示する日付(YYYY-MM-DD)")
+	channel := fs.Int("channel", 0, "表示するチャンネル(1から始まる番号、0の場合はすべて)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	day, err := parseDateFlag(*date)
+	if err != nil {
+		return err
+	}
+	channelCount := opts.Job.Schedule.ChannelCount
+	if *channel < 0 || *channel > channelCount {
+		return fmt.Errorf("channel must be between 1 and %v", channelCount)
+	}
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	s, err := schedule.Get(ctx, client, day, opts.Job.Schedule)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range s.Channels {
+		if *channel != 0 && *channel != i+1 {
+			continue
+		}
+
+		fmt.Printf("%v:\n", opts.ChannelName(i))
+		for _, it := range c.Items {
+			start := it.Time.In(broadcast.Location)
+			end := start.Add(it.Duration)
+			fmt.Printf("  %v-%v %v (%v)\n", start.Format("01-02 15:04:05"), end.Format("15:04:05"), it.VideoID, it.Duration)
+		}
+	}
+
+	return nil
+}
+
+func printLibraryVideo(v library.Entry) {
+	fmt.Printf("%6d %v %v %8v %v\n", v.Number, v.DocID, v.PublishedAt.In(broadcast.Location).Format("2006-01-02"), v.Duration, v.Title)
+}
+
+func libraryListCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("library list", flag.ContinueOnError)
+	offset := fs.Int("offset", 0, "表示を始める位置")
+	limit := fs.Int("limit", 50, "表示する件数")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	videos, _, err := library.Load(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].Number < videos[j].Number
+	})
+	for i := *offset; i < len(videos) && i < *offset+*limit; i++ {
+		printLibraryVideo(videos[i])
+	}
+
+	fmt.Printf("%v videos\n", len(videos))
+	return nil
+}
+
+// librarySearchCommand タイトルに大文字小文字を区別せずqueryを含む動画を表示する
+func librarySearchCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("query is required")
+	}
+	query := strings.ToLower(strings.Join(args, " "))
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	videos, _, err := library.Load(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].Number < videos[j].Number
+	})
+	count := 0
+	for _, v := range videos {
+		if strings.Contains(strings.ToLower(v.Title), query) {
+			printLibraryVideo(v)
+			count++
+		}
+	}
+
+	fmt.Printf("%v videos found\n", count)
+	return nil
+}
+
+// librarySeriesCommand シリーズごとに話数と次に放送する位置を表示する
+func librarySeriesCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("library series", flag.ContinueOnError)
+	rebuild := fs.Bool("rebuild", false, "動画が追加されていなくても見つけ直す")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := store.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var series []library.Series
+	if *rebuild {
+		series, err = library.RebuildSeries(ctx, client)
+	} else {
+		series, err = library.LoadSeries(ctx, client)
+	}
+	if err != nil {
+		return err
+	}
+
+	cursor, err := schedule.LoadSeriesCursor(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range series {
+		next := cursor.Position(s)
+		mark := ""
+		if s.ID == cursor.Daily {
+			mark = " (daily)"
+		}
+		fmt.Printf("%v: %v episodes, next #%v%v\n", s.Title, len(s.Episodes), s.Episodes[next].Number, mark)
+	}
+
+	fmt.Printf("%v series\n", len(series))
+	return nil
+}
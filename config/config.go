@@ -0,0 +1,289 @@
+// 設定ファイル
+// SIRO4_CONFIGで指定したYAMLファイル(省略時はsiro4.yamlがあれば)を起動時に読み込み、環境変数で上書きする
+// 読み込んだ後に書式を検査して、不正な値があれば起動しない
+// 値の範囲は設定から作成した各パッケージのOptionsで検査する
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+const DefaultPath = "siro4.yaml"
+
+// Duration YAMLでは30mのような文字列で指定する
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	err := unmarshal(&s)
+	if err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+type Storage struct {
+	// Backend 今はfirestoreのみ
+	Backend   string `yaml:"backend" json:"backend"`
+	ProjectID string `yaml:"projectId" json:"projectId"`
+	// EmulatorHost 指定した場合はFirestoreエミュレーターに接続する
+	EmulatorHost string `yaml:"emulatorHost" json:"emulatorHost,omitempty"`
+}
+
+type Source struct {
+	// ChannelID 動画を取得するYouTubeのチャンネル
+	ChannelID string `yaml:"channelId" json:"channelId"`
+	// Playlists 追加で取り込むプレイリストのID、他のチャンネルの動画も編成の候補になる
+	Playlists []string `yaml:"playlists" json:"playlists,omitempty"`
+}
+
+type Channel struct {
+	Name string `yaml:"name" json:"name"`
+	// Playlist 指定した場合はランダムではなくプレイリストの順番に放送する
+	// source.playlistsに含まれている必要がある
+	Playlist string `yaml:"playlist" json:"playlist,omitempty"`
+}
+
+type Scheduling struct {
+	Timezone string `yaml:"timezone" json:"timezone"`
+	// DayStart 放送日が切り替わる時刻(HH:MM)
+	DayStart string `yaml:"dayStart" json:"dayStart"`
+	// MaxVideoDuration これ以上の長さの動画は通常は編成しない
+	MaxVideoDuration Duration `yaml:"maxVideoDuration" json:"maxVideoDuration"`
+}
+
+type Window struct {
+	// Default /scheduleでdurationを省略した場合の長さ
+	Default Duration `yaml:"default" json:"default"`
+	Max     Duration `yaml:"max" json:"max"`
+}
+
+type Job struct {
+	// Scheduler appengine, internal, none
+	Scheduler  string `yaml:"scheduler" json:"scheduler"`
+	ExportCron string `yaml:"exportCron" json:"exportCron"`
+}
+
+type Live struct {
+	// Channel 配信中に差し替えるチャンネルの番号(1から)、0の場合は同時放送しない
+	Channel int `yaml:"channel" json:"channel"`
+	// Cron 配信の開始と終了を確認する間隔、job.schedulerがinternalの場合に使う
+	Cron string `yaml:"cron" json:"cron"`
+	// Hours 配信を確認する時間帯(HH:MM-HH:MM)、空の場合は1日中
+	Hours string `yaml:"hours" json:"hours,omitempty"`
+}
+
+type Events struct {
+	// Enabled /eventsでServer-Sent Eventsを配信する
+	// App Engine standardはレスポンスをバッファリングするので有効にしない
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+type Series struct {
+	// Mode off, block, daily
+	Mode string `yaml:"mode" json:"mode"`
+	// BlockSize blockの場合に続けて放送する話数
+	BlockSize int `yaml:"blockSize" json:"blockSize"`
+	// Slot dailyの場合に放送する時刻(HH:MM)、この時刻を過ぎた最初の番組になる
+	Slot string `yaml:"slot" json:"slot"`
+	// Channel dailyの場合に放送するチャンネルの番号(1から)
+	Channel int `yaml:"channel" json:"channel"`
+}
+
+// Config 設定ファイルの内容
+type Config struct {
+	Storage    Storage    `yaml:"storage" json:"storage"`
+	Source     Source     `yaml:"source" json:"source"`
+	Channels   []Channel  `yaml:"channels" json:"channels"`
+	Scheduling Scheduling `yaml:"scheduling" json:"scheduling"`
+	Window     Window     `yaml:"window" json:"window"`
+	Job        Job        `yaml:"job" json:"job"`
+	Live       Live       `yaml:"live" json:"live"`
+	Events     Events     `yaml:"events" json:"events"`
+	Series     Series     `yaml:"series" json:"series"`
+}
+
+// Default 設定ファイルがない場合の設定
+func Default() Config {
+	return Config{
+		Storage: Storage{
+			Backend:   "firestore",
+			ProjectID: "siro-4",
+		},
+		Source: Source{
+			ChannelID: "UCLhUvJ_wO9hOvv_yYENu4fQ",
+		},
+		Channels: []Channel{
+			{Name: "Channel 1"},
+			{Name: "Channel 2"},
+			{Name: "Channel 3"},
+			{Name: "Channel 4"},
+		},
+		Scheduling: Scheduling{
+			Timezone:         broadcast.DefaultTimezone,
+			DayStart:         "00:00",
+			MaxVideoDuration: Duration(30 * time.Minute),
+		},
+		Window: Window{
+			Default: Duration(3 * time.Hour),
+			Max:     Duration(48 * time.Hour),
+		},
+		// cron.yamlと同じく1時から30分ごとに実行する
+		Job: Job{
+			Scheduler:  "appengine",
+			ExportCron: "*/30 1-2 * * *",
+		},
+		Live: Live{
+			Cron: "*/2 * * * *",
+		},
+		Series: Series{
+			Mode:      "off",
+			BlockSize: 3,
+			Slot:      "20:00",
+			Channel:   1,
+		},
+	}
+}
+
+type ErrInvalid struct {
+	Issues []string
+}
+
+func (e ErrInvalid) Error() string {
+	return "invalid config: " + strings.Join(e.Issues, ", ")
+}
+
+// envOverrides 環境変数で上書きできる設定
+var envOverrides = []struct {
+	name  string
+	apply func(c *Config, v string)
+}{
+	{"SIRO4_PROJECT", func(c *Config, v string) { c.Storage.ProjectID = v }},
+	{"FIRESTORE_EMULATOR_HOST", func(c *Config, v string) { c.Storage.EmulatorHost = v }},
+	{"SIRO4_CHANNEL_ID", func(c *Config, v string) { c.Source.ChannelID = v }},
+	{"SIRO4_TIMEZONE", func(c *Config, v string) { c.Scheduling.Timezone = v }},
+	{"SIRO4_DAY_START", func(c *Config, v string) { c.Scheduling.DayStart = v }},
+	{"SIRO4_SCHEDULER", func(c *Config, v string) { c.Job.Scheduler = v }},
+	{"SIRO4_EXPORT_CRON", func(c *Config, v string) { c.Job.ExportCron = v }},
+	{"SIRO4_LIVE_CRON", func(c *Config, v string) { c.Live.Cron = v }},
+	{"SIRO4_LIVE_HOURS", func(c *Config, v string) { c.Live.Hours = v }},
+	{"SIRO4_EVENTS", func(c *Config, v string) { c.Events.Enabled = v == "true" }},
+	{"SIRO4_SERIES_MODE", func(c *Config, v string) { c.Series.Mode = v }},
+}
+
+// Load pathの設定ファイルを読み込んで環境変数で上書きする
+// pathが空の場合はSIRO4_CONFIG、それもなければsiro4.yamlがあれば読み込む
+func Load(path string) (Config, error) {
+	c := Default()
+
+	explicit := true
+	if path == "" {
+		path = os.Getenv("SIRO4_CONFIG")
+	}
+	if path == "" {
+		path = DefaultPath
+		explicit = false
+	}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		err = yaml.UnmarshalStrict(data, &c)
+		if err != nil {
+			return Config{}, fmt.Errorf("%v: %v", path, err)
+		}
+	case os.IsNotExist(err) && !explicit:
+	default:
+		return Config{}, err
+	}
+
+	for _, o := range envOverrides {
+		if v := os.Getenv(o.name); v != "" {
+			o.apply(&c, v)
+		}
+	}
+
+	return c, c.Validate()
+}
+
+// Validate 不正な値をまとめてErrInvalidで返す
+// 設定ファイルの中で確認できるものだけを検査する
+func (c Config) Validate() error {
+	var issues []string
+	add := func(format string, args ...interface{}) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+
+	if c.Storage.Backend != "firestore" {
+		add("storage.backend must be firestore")
+	}
+	if c.Storage.ProjectID == "" {
+		add("storage.projectId is required")
+	}
+	if c.Source.ChannelID == "" {
+		add("source.channelId is required")
+	}
+	if len(c.Channels) == 0 {
+		add("channels must not be empty")
+	}
+	playlists := map[string]struct{}{}
+	for i, id := range c.Source.Playlists {
+		if id == "" {
+			add("source.playlists[%v] is empty", i)
+		}
+		if _, ok := playlists[id]; ok {
+			add("source.playlists[%v] is duplicated", i)
+		}
+		playlists[id] = struct{}{}
+	}
+	for i, ch := range c.Channels {
+		if ch.Name == "" {
+			add("channels[%v].name is required", i)
+		}
+		if _, ok := playlists[ch.Playlist]; ch.Playlist != "" && !ok {
+			add("channels[%v].playlist must be in source.playlists", i)
+		}
+	}
+	if _, err := broadcast.LoadLocation(c.Scheduling.Timezone); err != nil {
+		add("scheduling.timezone: %v", err)
+	}
+	if _, err := broadcast.ParseDayStart(c.Scheduling.DayStart); err != nil {
+		add("scheduling.dayStart must be HH:MM")
+	}
+	if c.Scheduling.MaxVideoDuration <= 0 {
+		add("scheduling.maxVideoDuration must be positive")
+	}
+	if c.Window.Default <= 0 || c.Window.Max < c.Window.Default {
+		add("window.default must be positive and at most window.max")
+	}
+	if c.Live.Channel < 0 || c.Live.Channel > len(c.Channels) {
+		add("live.channel must be between 0 and the number of channels")
+	}
+	if _, err := broadcast.ParseDayStart(c.Series.Slot); err != nil {
+		add("series.slot must be HH:MM")
+	}
+
+	if len(issues) > 0 {
+		return ErrInvalid{Issues: issues}
+	}
+	return nil
+}
@@ -3,33 +3,17 @@ module github.com/yaegaki/ohohoi-bank
 go 1.12
 
 require (
-	cloud.google.com/go v0.51.0
+	cloud.google.com/go v0.51.0 // indirect
 	cloud.google.com/go/firestore v1.1.1
 	cloud.google.com/go/storage v1.5.0 // indirect
-	dmitri.shuralyov.com/gpu/mtl v0.0.0-20191203043605-d42048ed14fd // indirect
-	github.com/cncf/udpa/go v0.0.0-20191230090109-edbea6a78f6d // indirect
-	github.com/creack/pty v1.1.9 // indirect
-	github.com/envoyproxy/go-control-plane v0.9.2 // indirect
-	github.com/google/go-cmp v0.4.0 // indirect
-	github.com/hashicorp/golang-lru v0.5.3 // indirect
 	github.com/kr/pretty v0.2.0 // indirect
-	github.com/kr/pty v1.1.8 // indirect
-	github.com/labstack/echo v3.3.10+incompatible
 	github.com/labstack/echo/v4 v4.1.14
-	github.com/prometheus/client_model v0.1.0 // indirect
-	github.com/rogpeppe/go-internal v1.5.1 // indirect
-	github.com/stretchr/objx v0.2.0 // indirect
+	github.com/prometheus/client_golang v1.4.0
 	golang.org/x/crypto v0.0.0-20200109152110-61a87790db17 // indirect
-	golang.org/x/image v0.0.0-20191214001246-9130b4cfad52 // indirect
-	golang.org/x/mobile v0.0.0-20191210151939-1a1fef82734d // indirect
-	golang.org/x/mod v0.2.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
-	golang.org/x/sys v0.0.0-20200107162124-548cf772de50 // indirect
-	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
 	golang.org/x/tools v0.0.0-20200110213125-a7a6caa82ab2 // indirect
 	google.golang.org/api v0.15.0
-	google.golang.org/genproto v0.0.0-20200108215221-bd8f9a0ef82f
+	google.golang.org/genproto v0.0.0-20200108215221-bd8f9a0ef82f // indirect
 	google.golang.org/grpc v1.26.0
-	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
-	gopkg.in/yaml.v2 v2.2.7 // indirect
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,162 @@
+// cron形式(分 時 日 月 曜日)の実行時刻の指定
+// 時刻は放送のタイムゾーンで解釈する
+package job
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+// CronExpr 分 時 日 月 曜日の5フィールドのcron式
+type CronExpr struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// 日と曜日の両方が指定されている場合はどちらかに一致すればよい
+	domAny bool
+	dowAny bool
+}
+
+type ErrInvalidCronExpr struct {
+	Expr   string
+	Reason string
+}
+
+func (e ErrInvalidCronExpr) Error() string {
+	return fmt.Sprintf("invalid cron expression %q: %v", e.Expr, e.Reason)
+}
+
+// parseCronField 1つのフィールドを値の集合にする
+// *, 1,2,3, 1-5, */15, 1-30/5の形式に対応する
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			r := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(r[0])
+			hi, err2 = strconv.Atoi(r[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo = n
+			if step == 1 {
+				hi = n
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %v-%v", part, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// ParseCron cron式を解析する
+func ParseCron(expr string) (CronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return CronExpr{}, ErrInvalidCronExpr{Expr: expr, Reason: "expected 5 fields"}
+	}
+
+	var c CronExpr
+	var err error
+	targets := []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, t := range targets {
+		*t.bits, err = parseCronField(fields[i], t.min, t.max)
+		if err != nil {
+			return CronExpr{}, ErrInvalidCronExpr{Expr: expr, Reason: err.Error()}
+		}
+	}
+
+	// 日曜日は0と7のどちらでも指定できる
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+
+	return c, nil
+}
+
+func (c CronExpr) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// next tより後で最初に一致する時刻を返す
+// 5年以内に一致する時刻がない場合はゼロ値を返す
+func (c CronExpr) next(t time.Time) time.Time {
+	t = t.In(broadcast.Location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, broadcast.Location)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, broadcast.Location)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, broadcast.Location)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
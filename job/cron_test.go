@@ -0,0 +1,80 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+	}
+
+	for _, expr := range tests {
+		_, err := ParseCron(expr)
+		if _, ok := err.(ErrInvalidCronExpr); !ok {
+			t.Errorf("ParseCron(%q) = %v, want ErrInvalidCronExpr", expr, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, broadcast.Location)
+	}
+
+	tests := []struct {
+		expr string
+		t    time.Time
+		want time.Time
+	}{
+		{"* * * * *", at(2020, 1, 1, 0, 0), at(2020, 1, 1, 0, 1)},
+		{"*/2 * * * *", at(2020, 1, 1, 0, 1), at(2020, 1, 1, 0, 2)},
+		{"*/2 * * * *", at(2020, 1, 1, 0, 2), at(2020, 1, 1, 0, 4)},
+		{"*/30 1-2 * * *", at(2020, 1, 1, 0, 0), at(2020, 1, 1, 1, 0)},
+		{"*/30 1-2 * * *", at(2020, 1, 1, 1, 0), at(2020, 1, 1, 1, 30)},
+		{"*/30 1-2 * * *", at(2020, 1, 1, 2, 30), at(2020, 1, 2, 1, 0)},
+		{"0,15 3 * * *", at(2020, 1, 1, 3, 10), at(2020, 1, 1, 3, 15)},
+		{"1-30/10 0 * * *", at(2020, 1, 1, 0, 11), at(2020, 1, 1, 0, 21)},
+		// 月末をまたぐ
+		{"0 0 1 * *", at(2020, 1, 31, 12, 0), at(2020, 2, 1, 0, 0)},
+		{"0 0 29 2 *", at(2020, 3, 1, 0, 0), at(2024, 2, 29, 0, 0)},
+		{"0 12 * 6 *", at(2020, 1, 1, 0, 0), at(2020, 6, 1, 12, 0)},
+		// 2020/1/1は水曜日、日曜日は0と7のどちらでもよい
+		{"0 0 * * 0", at(2020, 1, 1, 0, 0), at(2020, 1, 5, 0, 0)},
+		{"0 0 * * 7", at(2020, 1, 1, 0, 0), at(2020, 1, 5, 0, 0)},
+		{"0 0 * * 1-5", at(2020, 1, 3, 12, 0), at(2020, 1, 6, 0, 0)},
+		// 日と曜日の両方を指定した場合はどちらかに一致すればよい
+		{"0 0 10 * 0", at(2020, 1, 1, 0, 0), at(2020, 1, 5, 0, 0)},
+		{"0 0 2 * 0", at(2020, 1, 1, 0, 0), at(2020, 1, 2, 0, 0)},
+		// 秒は切り捨てる
+		{"* * * * *", at(2020, 1, 1, 0, 0).Add(30 * time.Second), at(2020, 1, 1, 0, 1)},
+		// 存在しない日付
+		{"0 0 31 2 *", at(2020, 1, 1, 0, 0), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+		got := c.next(tt.t)
+		if !got.Equal(tt.want) {
+			t.Errorf("%q.next(%v) = %v, want %v", tt.expr, tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// 1日のうちの時間帯(HH:MM-HH:MM)の指定
+// 時刻は放送のタイムゾーンで解釈する
+package job
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+// Hours 1日のうちの時間帯、EndがStartより前の場合は日付をまたぐ
+// StartとEndが同じ場合は1日中
+type Hours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+type ErrInvalidHours struct {
+	Value string
+}
+
+func (e ErrInvalidHours) Error() string {
+	return fmt.Sprintf("invalid hours %q: must be HH:MM-HH:MM", e.Value)
+}
+
+// ParseHours HH:MM-HH:MMの形式を読み込む、空の場合は1日中
+func ParseHours(value string) (Hours, error) {
+	if value == "" {
+		return Hours{}, nil
+	}
+
+	r := strings.SplitN(value, "-", 2)
+	if len(r) != 2 || strings.TrimSpace(r[0]) == "" || strings.TrimSpace(r[1]) == "" {
+		return Hours{}, ErrInvalidHours{Value: value}
+	}
+	start, err1 := broadcast.ParseDayStart(strings.TrimSpace(r[0]))
+	end, err2 := broadcast.ParseDayStart(strings.TrimSpace(r[1]))
+	if err1 != nil || err2 != nil {
+		return Hours{}, ErrInvalidHours{Value: value}
+	}
+
+	return Hours{Start: start, End: end}, nil
+}
+
+// Contains 時刻tが時間帯に含まれるか
+func (h Hours) Contains(t time.Time) bool {
+	if h.Start == h.End {
+		return true
+	}
+
+	t = t.In(broadcast.Location)
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if h.Start < h.End {
+		return h.Start <= d && d < h.End
+	}
+	return h.Start <= d || d < h.End
+}
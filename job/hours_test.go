@@ -0,0 +1,68 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+func TestParseHours(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Hours
+	}{
+		{"", Hours{}},
+		{"18:00-02:00", Hours{Start: 18 * time.Hour, End: 2 * time.Hour}},
+		{"9:30 - 17:45", Hours{Start: 9*time.Hour + 30*time.Minute, End: 17*time.Hour + 45*time.Minute}},
+	}
+	for _, tt := range tests {
+		got, err := ParseHours(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseHours(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+
+	invalid := []string{"18:00", "18:00-", "-02:00", "25:00-02:00", "18:00-02:60", "evening"}
+	for _, value := range invalid {
+		if _, err := ParseHours(value); err == nil {
+			t.Errorf("ParseHours(%q) should return error", value)
+		}
+	}
+}
+
+func TestHoursContains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2020, 1, 1, hour, minute, 0, 0, broadcast.Location)
+	}
+
+	tests := []struct {
+		value string
+		t     time.Time
+		want  bool
+	}{
+		{"", at(3, 0), true},
+		{"09:00-17:00", at(9, 0), true},
+		{"09:00-17:00", at(16, 59), true},
+		{"09:00-17:00", at(17, 0), false},
+		{"09:00-17:00", at(8, 59), false},
+		// 日付をまたぐ
+		{"18:00-02:00", at(18, 0), true},
+		{"18:00-02:00", at(23, 59), true},
+		{"18:00-02:00", at(1, 59), true},
+		{"18:00-02:00", at(2, 0), false},
+		{"18:00-02:00", at(12, 0), false},
+		// 同じ時刻は1日中
+		{"00:00-00:00", at(12, 0), true},
+	}
+
+	for _, tt := range tests {
+		h, err := ParseHours(tt.value)
+		if err != nil {
+			t.Fatalf("ParseHours(%q) returned error: %v", tt.value, err)
+		}
+		if got := h.Contains(tt.t); got != tt.want {
+			t.Errorf("%q.Contains(%v) = %v, want %v", tt.value, tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// デイリーで行うジョブ
+// Youtubeから動画とプレイリストの情報を取得、スケジュールの作成を行う
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/jobrun"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
+	"github.com/yaegaki/ohohoi-bank/youtube"
+)
+
+// Export 動画の取得とスケジュールの作成を行い、実行履歴を保存する
+func Export(ctx context.Context, opts Options) (err error) {
+	start := time.Now()
+	id := logging.JobRunID(ctx)
+	if id == "" {
+		id = logging.NewID()
+		ctx = logging.WithJobRunID(ctx, id)
+	}
+	run := jobrun.New(id, "export")
+	ctx = jobrun.WithRun(ctx, run)
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		metrics.ExportJobRuns.WithLabelValues(result).Inc()
+		metrics.ExportJobDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	client, err := store.Shared()
+	if err != nil {
+		return err
+	}
+
+	// 履歴の保存に失敗してもジョブ自体は続ける
+	if serr := jobrun.Save(ctx, client, run); serr != nil {
+		logging.Warning(ctx, "Can't save job run", logging.Fields{
+			"error": serr,
+		})
+	}
+	defer func() {
+		run.Finish(err)
+		if serr := jobrun.Save(ctx, client, run); serr != nil {
+			logging.Warning(ctx, "Can't save job run", logging.Fields{
+				"error": serr,
+			})
+		}
+	}()
+
+	service, err := youtube.NewService(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = run.RunPhase("video", func() error {
+		return youtube.ExportVideos(ctx, service, client, opts.ChannelID)
+	})
+	if err != nil {
+		logging.Error(ctx, "Can't export video", logging.Fields{
+			"error": err,
+		})
+		return err
+	}
+
+	// プレイリストを取り込めなくても前回取り込んだものでスケジュールを作成する
+	err = run.RunPhase("playlist", func() error {
+		return youtube.ExportPlaylists(ctx, service, client, opts.Schedule.PlaylistIDs)
+	})
+	if err != nil {
+		logging.Warning(ctx, "Can't export playlist", logging.Fields{
+			"error": err,
+		})
+	}
+
+	err = run.RunPhase("schedule", func() error {
+		return schedule.Export(ctx, client, opts.Schedule)
+	})
+	if err != nil {
+		logging.Error(ctx, "Can't export schedule", logging.Fields{
+			"error": err,
+		})
+		return err
+	}
+
+	return nil
+}
+
+// RunExport 実行IDを付けてExportを実行する
+func RunExport(ctx context.Context, opts Options) error {
+	ctx = logging.WithJobRunID(ctx, logging.NewID())
+	logging.Info(ctx, "export task start", nil)
+	return Export(ctx, opts)
+}
@@ -0,0 +1,77 @@
+// ライブ配信の同時放送を切り替えるジョブ
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
+	"github.com/yaegaki/ohohoi-bank/youtube"
+)
+
+// PollLive ソースのチャンネルが配信中かを確認して同時放送を切り替える
+// 同時放送するチャンネルが設定されていない場合は何もしない
+// 確認する時間帯の外では配信中の場合だけYouTube APIを呼び出して配信の終了を確認する
+func PollLive(ctx context.Context, opts Options) error {
+	if opts.Schedule.LiveChannel < 0 {
+		return nil
+	}
+
+	hours, err := ParseHours(opts.LiveHours)
+	if err != nil {
+		return err
+	}
+
+	client, err := store.Shared()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	current, live, err := schedule.GetLive(ctx, client, now, opts.Schedule)
+	if err != nil {
+		return err
+	}
+	if !live && !hours.Contains(now) {
+		return nil
+	}
+
+	service, err := youtube.NewService(ctx)
+	if err != nil {
+		return err
+	}
+
+	stream, found, err := youtube.FindLive(ctx, service, client, opts.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		if !live {
+			return nil
+		}
+
+		logging.Info(ctx, "live ended", logging.Fields{
+			"videoId": current.VideoID,
+		})
+		return schedule.SaveLive(ctx, client, schedule.Live{})
+	}
+
+	if !live || current.VideoID != stream.VideoID {
+		logging.Info(ctx, "live started", logging.Fields{
+			"videoId": stream.VideoID,
+			"title":   stream.Title,
+			"channel": opts.Schedule.LiveChannel + 1,
+		})
+	}
+
+	// 配信中であることを確認した時刻を更新し続ける
+	return schedule.SaveLive(ctx, client, schedule.Live{
+		VideoID:   stream.VideoID,
+		Title:     stream.Title,
+		StartedAt: stream.StartedAt,
+		CheckedAt: now,
+	})
+}
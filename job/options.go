@@ -0,0 +1,75 @@
+// ジョブの設定
+package job
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/schedule"
+)
+
+// Options 設定ファイルから作成して、ジョブを実行する関数に渡す
+type Options struct {
+	// Scheduler SchedulerAppEngine, SchedulerInternal, SchedulerNone
+	Scheduler  string
+	ExportCron string
+	// LiveCron 配信の開始と終了を確認する間隔、SchedulerInternalの場合に使う
+	LiveCron string
+	// LiveHours 配信を確認する時間帯(HH:MM-HH:MM)、空の場合は1日中
+	// 時間帯の外では配信中と保存されている場合だけ確認する
+	LiveHours string
+	// ChannelID 動画を取得するYouTubeのチャンネル
+	ChannelID string
+	Schedule  schedule.Options
+}
+
+type ErrInvalidOptions struct {
+	Issues []string
+}
+
+func (e ErrInvalidOptions) Error() string {
+	return "invalid job options: " + strings.Join(e.Issues, ", ")
+}
+
+// Validate 不正な値をまとめてErrInvalidOptionsで返す
+// スケジュールの設定はschedule.Options.Validateのエラーをそのまま返す
+func (o Options) Validate() error {
+	var issues []string
+	add := func(format string, args ...interface{}) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+
+	switch o.Scheduler {
+	case SchedulerAppEngine, SchedulerInternal, SchedulerNone:
+	default:
+		add("scheduler must be appengine, internal or none")
+	}
+	if _, err := ParseCron(o.ExportCron); err != nil {
+		add("export cron: %v", err)
+	}
+	if _, err := ParseCron(o.LiveCron); err != nil {
+		add("live cron: %v", err)
+	}
+	if _, err := ParseHours(o.LiveHours); err != nil {
+		add("live hours: %v", err)
+	}
+	if o.ChannelID == "" {
+		add("channel id is required")
+	}
+
+	if len(issues) > 0 {
+		return ErrInvalidOptions{Issues: issues}
+	}
+	return o.Schedule.Validate()
+}
+
+// NextExport tより後で最初にエクスポートを実行する時刻
+// job.schedulerがappengineの場合もcron.yamlと同じ時刻をExportCronに設定しておく
+func (o Options) NextExport(t time.Time) time.Time {
+	c, err := ParseCron(o.ExportCron)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.next(t)
+}
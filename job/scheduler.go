@@ -0,0 +1,141 @@
+// プロセス内でジョブを定期実行するスケジューラー
+// App Engineのcronを使えない環境(Cloud Run、Kubernetesなど)では設定ファイルのjob.scheduler(SIRO4_SCHEDULER)をinternalにする
+// 複数のインスタンスで動いている場合はリースを取得できたインスタンスだけが実行する
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/store"
+)
+
+const (
+	// SchedulerAppEngine App Engineのcronから/_task/exportが呼ばれる
+	SchedulerAppEngine = "appengine"
+	// SchedulerInternal プロセス内のスケジューラーで実行する
+	SchedulerInternal = "internal"
+	// SchedulerNone 自動では実行しない、認証付きのトリガーからのみ実行する
+	SchedulerNone = "none"
+)
+
+// cron.yamlと同じく1時から30分ごとに実行する
+const DefaultExportCron = "*/30 1-2 * * *"
+
+// DefaultLiveCron 配信の開始と終了をこの間隔で確認する
+const DefaultLiveCron = "*/2 * * * *"
+
+// ジョブの実行にかかる時間より長くしておく
+// 実行中にインスタンスが落ちた場合はこの時間が経つと他のインスタンスが実行できる
+const leaseTTL = 15 * time.Minute
+
+type scheduledJob struct {
+	name string
+	expr CronExpr
+	run  func(ctx context.Context) error
+}
+
+// StartScheduler opts.SchedulerがSchedulerInternalの場合にスケジューラーを開始する
+func StartScheduler(ctx context.Context, opts Options) error {
+	if opts.Scheduler != SchedulerInternal {
+		return nil
+	}
+
+	err := startScheduledJob(ctx, "export", opts.ExportCron, func(ctx context.Context) error {
+		return RunExport(ctx, opts)
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.Schedule.LiveChannel >= 0 {
+		err = startScheduledJob(ctx, "live", opts.LiveCron, func(ctx context.Context) error {
+			return PollLive(ctx, opts)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func startScheduledJob(ctx context.Context, name, spec string, run func(ctx context.Context) error) error {
+	expr, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+
+	go runScheduledJob(ctx, scheduledJob{
+		name: name,
+		expr: expr,
+		run:  run,
+	})
+
+	logging.Info(ctx, "job scheduler started", logging.Fields{
+		"job":        name,
+		"cron":       spec,
+		"instanceId": lease.InstanceID,
+	})
+	return nil
+}
+
+func runScheduledJob(ctx context.Context, job scheduledJob) {
+	for {
+		next := job.expr.next(time.Now())
+		if next.IsZero() {
+			logging.Error(ctx, "no next run time", logging.Fields{
+				"job": job.name,
+			})
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runWithLease(ctx, job)
+	}
+}
+
+// runWithLease リースを取得できた場合だけジョブを実行する
+func runWithLease(ctx context.Context, job scheduledJob) {
+	client, err := store.Shared()
+	if err != nil {
+		logging.Error(ctx, "Can't get firestore client", logging.Fields{
+			"job":   job.name,
+			"error": err,
+		})
+		return
+	}
+
+	lock, err := lease.AcquireLock(ctx, client, "scheduler-"+job.name, leaseTTL)
+	if _, ok := err.(lease.ErrLockHeld); ok {
+		logging.Info(ctx, "job is running on another instance", logging.Fields{
+			"job": job.name,
+		})
+		return
+	}
+	if err != nil {
+		logging.Error(ctx, "Can't acquire lock", logging.Fields{
+			"job":   job.name,
+			"error": err,
+		})
+		return
+	}
+	defer lock.Release(ctx)
+
+	err = job.run(ctx)
+	if err != nil {
+		logging.Error(ctx, "scheduled job failed", logging.Fields{
+			"job":   job.name,
+			"error": err,
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// ジョブの実行履歴
+// job.Exportの実行ごとにJobRunコレクションへ記録し、管理画面で直近の実行結果を確認できるようにする
+package jobrun
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+const (
+	Running = "running"
+	Success = "success"
+	Failure = "failure"
+)
+
+// cronは毎日実行されるので、これ以上成功していない場合は止まっているとみなす
+const StaleAfter = 26 * time.Hour
+
+type Phase struct {
+	Name       string    `firestore:"name" json:"name"`
+	StartedAt  time.Time `firestore:"startedAt" json:"startedAt"`
+	FinishedAt time.Time `firestore:"finishedAt" json:"finishedAt"`
+	Error      string    `firestore:"error" json:"error,omitempty"`
+}
+
+// Run ジョブの1回の実行
+type Run struct {
+	ID         string    `firestore:"id" json:"id"`
+	Job        string    `firestore:"job" json:"job"`
+	Result     string    `firestore:"result" json:"result"`
+	StartedAt  time.Time `firestore:"startedAt" json:"startedAt"`
+	FinishedAt time.Time `firestore:"finishedAt" json:"finishedAt"`
+	Phases     []Phase   `firestore:"phases" json:"phases"`
+	// VideosIngested 追加された動画の数
+	VideosIngested int `firestore:"videosIngested" json:"videosIngested"`
+	// QuotaUsed 消費したYouTube Data APIのクォータ
+	QuotaUsed float64 `firestore:"quotaUsed" json:"quotaUsed"`
+	// ScheduleDates 作成したスケジュールの日付
+	ScheduleDates []string `firestore:"scheduleDates" json:"scheduleDates"`
+	Error         string   `firestore:"error" json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// Status 最後に成功した日時など、履歴を遡らずに確認したいもの
+type Status struct {
+	LastRunID       string    `firestore:"lastRunId" json:"lastRunId"`
+	LastRunAt       time.Time `firestore:"lastRunAt" json:"lastRunAt"`
+	LastResult      string    `firestore:"lastResult" json:"lastResult"`
+	LastSuccessAt   time.Time `firestore:"lastSuccessAt" json:"lastSuccessAt"`
+	LastIngestionAt time.Time `firestore:"lastIngestionAt" json:"lastIngestionAt"`
+}
+
+type runKey struct{}
+
+// New 実行中のRunを作成する
+func New(id, job string) *Run {
+	return &Run{
+		ID:            id,
+		Job:           job,
+		Result:        Running,
+		StartedAt:     time.Now(),
+		Phases:        []Phase{},
+		ScheduleDates: []string{},
+	}
+}
+
+// WithRun FromContextで取り出せるようにrunをコンテキストに設定する
+func WithRun(ctx context.Context, run *Run) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+// FromContext ジョブの外から呼ばれた場合はnilを返す
+// nilのままでも各メソッドは呼び出せる
+func FromContext(ctx context.Context) *Run {
+	run, _ := ctx.Value(runKey{}).(*Run)
+	return run
+}
+
+func (r *Run) AddVideos(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.VideosIngested += n
+}
+
+func (r *Run) AddQuota(units float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.QuotaUsed += units
+}
+
+func (r *Run) AddScheduleDate(key string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ScheduleDates = append(r.ScheduleDates, key)
+}
+
+// RunPhase nameの処理を実行して開始・終了時刻とエラーを記録する
+func (r *Run) RunPhase(name string, f func() error) error {
+	p := Phase{
+		Name:      name,
+		StartedAt: time.Now(),
+	}
+	err := f()
+	p.FinishedAt = time.Now()
+	if err != nil {
+		p.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.Phases = append(r.Phases, p)
+	r.mu.Unlock()
+	return err
+}
+
+// Finish errから結果を決めて終了時刻を記録する
+func (r *Run) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FinishedAt = time.Now()
+	if err != nil {
+		r.Result = Failure
+		r.Error = err.Error()
+	} else {
+		r.Result = Success
+	}
+}
+
+// Save 実行中の状態も保存しておき、途中で落ちた場合はrunningのまま残るようにする
+func Save(ctx context.Context, storeClient *firestore.Client, r *Run) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := storeClient.Collection("JobRun").Doc(r.ID).Set(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	if r.Result == Running {
+		return nil
+	}
+
+	var s Status
+	ref := storeClient.Collection("Info").Doc("JobStatus")
+	metrics.CountFirestoreReads("job_status", 1)
+	snap, err := ref.Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	if snap.Exists() {
+		snap.DataTo(&s)
+	}
+
+	s.LastRunID = r.ID
+	s.LastRunAt = r.StartedAt
+	s.LastResult = r.Result
+	if r.Result == Success {
+		s.LastSuccessAt = r.FinishedAt
+	}
+	for _, p := range r.Phases {
+		if p.Name == "video" && p.Error == "" {
+			s.LastIngestionAt = p.FinishedAt
+		}
+	}
+
+	_, err = ref.Set(ctx, s)
+	return err
+}
+
+// GetStatus 最後の実行の状態を返す、まだ実行されていない場合はゼロ値
+func GetStatus(ctx context.Context, storeClient *firestore.Client) (Status, error) {
+	var s Status
+	metrics.CountFirestoreReads("job_status", 1)
+	snap, err := storeClient.Collection("Info").Doc("JobStatus").Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return s, nil
+		}
+		return s, err
+	}
+
+	err = snap.DataTo(&s)
+	return s, err
+}
+
+// List 新しい順にlimit件返す
+func List(ctx context.Context, storeClient *firestore.Client, limit int) ([]*Run, error) {
+	docs, err := storeClient.Collection("JobRun").
+		OrderBy("startedAt", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, err
+	}
+	metrics.CountFirestoreReads("job_run", len(docs))
+
+	runs := make([]*Run, 0, len(docs))
+	for _, doc := range docs {
+		var r Run
+		err = doc.DataTo(&r)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, &r)
+	}
+
+	return runs, nil
+}
+
+// Stale 最後に成功してからStaleAfter以上経っているか
+func (s Status) Stale(now time.Time) bool {
+	return s.LastSuccessAt.IsZero() || now.Sub(s.LastSuccessAt) > StaleAfter
+}
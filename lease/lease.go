@@ -0,0 +1,246 @@
+// Firestoreに保存するリース
+// 複数のインスタンスや重なって実行されたジョブで、同じ処理を1つだけが実行するために使う
+// リースは取得されるたびにTokenが増えるので、期限切れに気づかずに処理を続けた古い保持者の書き込みは
+// RunFencedでTokenを確認して拒否する
+package lease
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// Lease Lockコレクションにリースの名前ごとに保存する
+type Lease struct {
+	Holder    string    `firestore:"holder"`
+	ExpiresAt time.Time `firestore:"expiresAt"`
+	// Token 取得されるたびに増える値
+	// 解放してもドキュメントは消さずに残し、Tokenが戻らないようにする
+	Token int64 `firestore:"token"`
+}
+
+// ExportTTL エクスポートのロックのリースの期間
+// 動画の取得はYouTube APIの呼び出しを含むので長めにしておく
+const ExportTTL = 5 * time.Minute
+
+// InstanceID このプロセスを識別するID
+var InstanceID = logging.NewID()
+
+// ErrLockHeld 他の保持者が期限内のリースを持っている
+type ErrLockHeld struct {
+	Name string
+}
+
+func (e ErrLockHeld) Error() string {
+	return fmt.Sprintf("lock %v is held by another holder", e.Name)
+}
+
+// ErrLeaseLost 期限が切れて他の保持者に取得されたか、解放されている
+type ErrLeaseLost struct {
+	Name string
+}
+
+func (e ErrLeaseLost) Error() string {
+	return fmt.Sprintf("lease %v is lost", e.Name)
+}
+
+func (l Lease) validAt(t time.Time) bool {
+	return l.Holder != "" && t.Before(l.ExpiresAt)
+}
+
+// Acquire nameのリースをholderとしてttlの間取得する
+// 他のholderが期限内のリースを持っている場合はfalseを返す
+// 自分が持っている場合はTokenを変えずに期限を延長する
+func Acquire(ctx context.Context, storeClient *firestore.Client, name, holder string, ttl time.Duration) (Lease, bool, error) {
+	ref := storeClient.Collection("Lock").Doc(name)
+	var result Lease
+	acquired := false
+	err := storeClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		metrics.CountFirestoreReads("lock", 1)
+		snap, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		now := time.Now()
+		var l Lease
+		if snap.Exists() {
+			err = snap.DataTo(&l)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case l.Holder == holder && l.validAt(now):
+		case l.validAt(now):
+			return nil
+		default:
+			l.Token++
+			l.Holder = holder
+		}
+		l.ExpiresAt = now.Add(ttl)
+
+		acquired = true
+		result = l
+		return tx.Set(ref, l)
+	})
+	if err != nil {
+		return Lease{}, false, err
+	}
+
+	return result, acquired, nil
+}
+
+// Release holderが持っているリースを解放する
+// 期限が切れて他のholderに取得されている場合は何もしない
+func Release(ctx context.Context, storeClient *firestore.Client, name, holder string) error {
+	ref := storeClient.Collection("Lock").Doc(name)
+	return storeClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		metrics.CountFirestoreReads("lock", 1)
+		snap, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+
+		var l Lease
+		err = snap.DataTo(&l)
+		if err != nil {
+			return err
+		}
+		if l.Holder != holder {
+			return nil
+		}
+
+		return tx.Set(ref, Lease{
+			Token: l.Token,
+		})
+	})
+}
+
+// Lock 取得したリースを期限が切れる前に延長し続けるロック
+type Lock struct {
+	client *firestore.Client
+	name   string
+	holder string
+	token  int64
+	ttl    time.Duration
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// AcquireLock nameのロックを取得する
+// 他で取得されている場合はErrLockHeldを返す
+func AcquireLock(ctx context.Context, storeClient *firestore.Client, name string, ttl time.Duration) (*Lock, error) {
+	holder := InstanceID + "-" + logging.NewID()
+	l, ok, err := Acquire(ctx, storeClient, name, holder, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockHeld{Name: name}
+	}
+
+	lock := &Lock{
+		client: storeClient,
+		name:   name,
+		holder: holder,
+		token:  l.Token,
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lock.keepAlive(ctx)
+
+	logging.Info(ctx, "lock acquired", logging.Fields{
+		"lock":  name,
+		"token": l.Token,
+	})
+	return lock, nil
+}
+
+// keepAlive ttlの1/3ごとにリースを延長する
+// 延長できなかった場合はRunFencedで書き込みが拒否される
+func (l *Lock) keepAlive(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewed, ok, err := Acquire(ctx, l.client, l.name, l.holder, l.ttl)
+		if err != nil {
+			logging.Warning(ctx, "Can't renew lock", logging.Fields{
+				"lock":  l.name,
+				"error": err,
+			})
+			continue
+		}
+		if !ok || renewed.Token != l.token {
+			logging.Error(ctx, "lock lost", logging.Fields{
+				"lock":  l.name,
+				"token": l.token,
+			})
+			return
+		}
+	}
+}
+
+// RunFenced リースをまだ持っていることをトランザクション内で確認してからfで書き込む
+// fで読み込む場合は書き込みより前に行うこと
+func (l *Lock) RunFenced(ctx context.Context, f func(tx *firestore.Transaction) error) error {
+	ref := l.client.Collection("Lock").Doc(l.name)
+	return l.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		metrics.CountFirestoreReads("lock", 1)
+		snap, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return ErrLeaseLost{Name: l.name}
+			}
+			return err
+		}
+
+		var current Lease
+		err = snap.DataTo(&current)
+		if err != nil {
+			return err
+		}
+		if current.Holder != l.holder || current.Token != l.token || !current.validAt(time.Now()) {
+			return ErrLeaseLost{Name: l.name}
+		}
+
+		return f(tx)
+	})
+}
+
+// Release 延長を止めてリースを解放する
+func (l *Lock) Release(ctx context.Context) {
+	close(l.stop)
+	<-l.done
+
+	err := Release(ctx, l.client, l.name, l.holder)
+	if err != nil {
+		logging.Warning(ctx, "Can't release lock", logging.Fields{
+			"lock":  l.name,
+			"error": err,
+		})
+	}
+}
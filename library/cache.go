@@ -0,0 +1,38 @@
+// 動画インデックスのキャッシュ
+package library
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/cache"
+)
+
+const indexCacheTTL = time.Hour
+
+var indexCache = cache.New()
+
+const indexCacheKey = "index"
+
+// CachedIndex キャッシュを経由してインデックスを取得する
+func CachedIndex(ctx context.Context, storeClient *firestore.Client) (Index, error) {
+	v, ok := indexCache.Get(indexCacheKey)
+	if ok {
+		return v.(Index), nil
+	}
+
+	idx, err := LoadIndex(ctx, storeClient)
+	if err != nil {
+		return Index{}, err
+	}
+
+	indexCache.Set(indexCacheKey, idx, indexCacheTTL)
+	return idx, nil
+}
+
+// InvalidateIndex 動画が追加された場合に呼び出す
+func InvalidateIndex() {
+	indexCache.Delete(indexCacheKey)
+}
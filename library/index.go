@@ -0,0 +1,248 @@
+// 動画のIDと長さをまとめたインデックス
+// 全動画分を1つのドキュメントに詰めて保存しておくことで、
+// スケジュール作成時の動画の抽選を1回の読み込みで行えるようにする
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// IndexEntry インデックスの1動画分
+type IndexEntry struct {
+	ID          string
+	Duration    time.Duration
+	PublishedAt time.Time
+}
+
+// Index スケジュールの作成に使う全動画のID、長さ、公開日時
+type Index struct {
+	Entries []IndexEntry
+}
+
+// indexForStore Firestoreに保存する形式
+// 1エントリあたり20バイト程度なので1MBのドキュメントに4万件程度は入る
+type indexForStore struct {
+	Count     int       `firestore:"count"`
+	Data      []byte    `firestore:"data"`
+	UpdatedAt time.Time `firestore:"updatedAt"`
+}
+
+type ErrInvalidIndex struct{}
+
+func (ErrInvalidIndex) Error() string {
+	return "invalid video index"
+}
+
+// ErrIndexIDTooLong IDの長さは1バイトで保存するので255バイトを超えるIDは保存できない
+type ErrIndexIDTooLong struct {
+	ID string
+}
+
+func (e ErrIndexIDTooLong) Error() string {
+	return fmt.Sprintf("video id %q is too long for the index", e.ID)
+}
+
+// maxIndexIDLength IDの長さを保存する1バイトで表せる最大の長さ
+const maxIndexIDLength = 255
+
+func (idx Index) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, e := range idx.Entries {
+		if len(e.ID) > maxIndexIDLength {
+			return nil, ErrIndexIDTooLong{ID: e.ID}
+		}
+		buf.WriteByte(byte(len(e.ID)))
+		buf.WriteString(e.ID)
+		n := binary.PutUvarint(tmp, uint64(e.Duration/time.Second))
+		buf.Write(tmp[:n])
+		n = binary.PutVarint(tmp, e.PublishedAt.Unix())
+		buf.Write(tmp[:n])
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeIndex 保存されている形式から戻す
+// 途中で切れている、もしくは件数がcountと一致しない場合はErrInvalidIndexを返す
+func DecodeIndex(data []byte, count int) (Index, error) {
+	r := bytes.NewReader(data)
+	entries := make([]IndexEntry, 0, count)
+	for r.Len() > 0 {
+		l, err := r.ReadByte()
+		if err != nil {
+			return Index{}, ErrInvalidIndex{}
+		}
+		id := make([]byte, l)
+		_, err = io.ReadFull(r, id)
+		if err != nil {
+			return Index{}, ErrInvalidIndex{}
+		}
+		seconds, err := binary.ReadUvarint(r)
+		if err != nil {
+			return Index{}, ErrInvalidIndex{}
+		}
+		publishedAt, err := binary.ReadVarint(r)
+		if err != nil {
+			return Index{}, ErrInvalidIndex{}
+		}
+
+		entries = append(entries, IndexEntry{
+			ID:          string(id),
+			Duration:    time.Duration(seconds) * time.Second,
+			PublishedAt: time.Unix(publishedAt, 0).In(broadcast.Location),
+		})
+	}
+
+	if len(entries) != count {
+		return Index{}, ErrInvalidIndex{}
+	}
+
+	return Index{
+		Entries: entries,
+	}, nil
+}
+
+func indexDoc(storeClient *firestore.Client) *firestore.DocumentRef {
+	return storeClient.Collection("Info").Doc("VideoIndex")
+}
+
+// LoadIndex インデックスを読み込む
+// インデックスが存在しない、もしくはVideoCountと件数が一致しない場合はVideoコレクションから作り直す
+func LoadIndex(ctx context.Context, storeClient *firestore.Client) (Index, error) {
+	metrics.CountFirestoreReads("index", 2)
+	snap, err := storeClient.Collection("Info").Doc("VideoStatistics").Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return Index{}, ErrStatisticsNotExists{}
+		}
+		return Index{}, err
+	}
+	var statistics Statistics
+	snap.DataTo(&statistics)
+
+	snap, err = indexDoc(storeClient).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return Index{}, err
+	}
+
+	if snap.Exists() {
+		var s indexForStore
+		snap.DataTo(&s)
+		if s.Count == statistics.VideoCount {
+			idx, err := DecodeIndex(s.Data, s.Count)
+			if err == nil {
+				return idx, nil
+			}
+		}
+	}
+
+	logging.Info(ctx, "rebuild video index", logging.Fields{
+		"videoCount": statistics.VideoCount,
+	})
+	return RebuildIndex(ctx, storeClient)
+}
+
+// RebuildIndex Videoコレクションからインデックスを作り直して保存する
+func RebuildIndex(ctx context.Context, storeClient *firestore.Client) (Index, error) {
+	iter := storeClient.Collection("Video").OrderBy("number", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	idx := Index{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return Index{}, err
+		}
+
+		metrics.CountFirestoreReads("index_rebuild", 1)
+		var v Video
+		doc.DataTo(&v)
+		idx.Entries = append(idx.Entries, IndexEntry{
+			ID:          v.ID,
+			Duration:    v.Duration,
+			PublishedAt: v.PublishedAt,
+		})
+	}
+
+	err := SaveIndex(ctx, storeClient, idx)
+	if err != nil {
+		return Index{}, err
+	}
+
+	return idx, nil
+}
+
+// SaveIndex インデックスを保存する
+func SaveIndex(ctx context.Context, storeClient *firestore.Client, idx Index) error {
+	data, err := idx.encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = indexDoc(storeClient).Set(ctx, indexForStore{
+		Count:     len(idx.Entries),
+		Data:      data,
+		UpdatedAt: time.Now(),
+	})
+	InvalidateIndex()
+	return err
+}
+
+// AppendIndex 新しくエクスポートした動画をインデックスに追加する
+// prevCountはエクスポート前のVideoCount
+func AppendIndex(ctx context.Context, storeClient *firestore.Client, prevCount int, videos []Video) error {
+	metrics.CountFirestoreReads("index", 1)
+	snap, err := indexDoc(storeClient).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	idx := Index{}
+	if snap.Exists() {
+		var s indexForStore
+		snap.DataTo(&s)
+		idx, err = DecodeIndex(s.Data, s.Count)
+		if err != nil || s.Count != prevCount {
+			// 追加するだけでは整合性がとれないので作り直す
+			_, err = RebuildIndex(ctx, storeClient)
+			return err
+		}
+	} else if prevCount > 0 {
+		_, err = RebuildIndex(ctx, storeClient)
+		return err
+	}
+
+	for _, v := range videos {
+		idx.Entries = append(idx.Entries, IndexEntry{
+			ID:          v.ID,
+			Duration:    v.Duration,
+			PublishedAt: v.PublishedAt,
+		})
+	}
+
+	return SaveIndex(ctx, storeClient, idx)
+}
+
+type ErrStatisticsNotExists struct{}
+
+func (ErrStatisticsNotExists) Error() string {
+	return "VideoStatistics doesn't exist"
+}
@@ -0,0 +1,105 @@
+package library
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+func TestIndexEncodeDecode(t *testing.T) {
+	idx := Index{
+		Entries: []IndexEntry{
+			{ID: "dQw4w9WgXcQ", Duration: 3*time.Minute + 33*time.Second, PublishedAt: time.Unix(1255000000, 0)},
+			{ID: "a", Duration: 0, PublishedAt: time.Unix(0, 0)},
+			// 1970年より前の時刻は負の値になる
+			{ID: strings.Repeat("x", maxIndexIDLength), Duration: 10 * time.Hour, PublishedAt: time.Unix(-86400, 0)},
+		},
+	}
+
+	data, err := idx.encode()
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	got, err := DecodeIndex(data, len(idx.Entries))
+	if err != nil {
+		t.Fatalf("DecodeIndex returned error: %v", err)
+	}
+
+	if len(got.Entries) != len(idx.Entries) {
+		t.Fatalf("DecodeIndex returned %v entries, want %v", len(got.Entries), len(idx.Entries))
+	}
+	for i, e := range got.Entries {
+		want := idx.Entries[i]
+		if e.ID != want.ID || e.Duration != want.Duration || !e.PublishedAt.Equal(want.PublishedAt) {
+			t.Errorf("entry %v = %+v, want %+v", i, e, want)
+		}
+		if e.PublishedAt.Location() != broadcast.Location {
+			t.Errorf("entry %v is in %v, want %v", i, e.PublishedAt.Location(), broadcast.Location)
+		}
+	}
+}
+
+func TestIndexEncodeTruncatesDuration(t *testing.T) {
+	idx := Index{
+		Entries: []IndexEntry{{ID: "a", Duration: 1500 * time.Millisecond, PublishedAt: time.Unix(0, 0)}},
+	}
+
+	data, err := idx.encode()
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+	got, err := DecodeIndex(data, 1)
+	if err != nil {
+		t.Fatalf("DecodeIndex returned error: %v", err)
+	}
+	if got.Entries[0].Duration != time.Second {
+		t.Errorf("Duration = %v, want %v", got.Entries[0].Duration, time.Second)
+	}
+}
+
+func TestIndexEncodeTooLongID(t *testing.T) {
+	id := strings.Repeat("x", maxIndexIDLength+1)
+	_, err := Index{Entries: []IndexEntry{{ID: id}}}.encode()
+	if _, ok := err.(ErrIndexIDTooLong); !ok {
+		t.Errorf("encode returned %v, want ErrIndexIDTooLong", err)
+	}
+}
+
+func TestDecodeIndexInvalid(t *testing.T) {
+	idx := Index{
+		Entries: []IndexEntry{
+			{ID: "abc", Duration: time.Minute, PublishedAt: time.Unix(1600000000, 0)},
+			{ID: "def", Duration: time.Hour, PublishedAt: time.Unix(1600000000, 0)},
+		},
+	}
+	data, err := idx.encode()
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		count int
+	}{
+		{"fewer entries than count", data, 3},
+		{"more entries than count", data, 1},
+		{"truncated id", data[:len(data)-8], 2},
+		{"truncated varint", data[:len(data)-1], 2},
+		{"only length", []byte{5}, 1},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeIndex(tt.data, tt.count)
+		if _, ok := err.(ErrInvalidIndex); !ok {
+			t.Errorf("%v: DecodeIndex returned %v, want ErrInvalidIndex", tt.name, err)
+		}
+	}
+
+	empty, err := DecodeIndex(nil, 0)
+	if err != nil || len(empty.Entries) != 0 {
+		t.Errorf("DecodeIndex(nil, 0) = %v, %v, want empty index", empty, err)
+	}
+}
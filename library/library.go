@@ -0,0 +1,277 @@
+// Videoコレクションの整合性チェックとNumberの振り直し
+// Numberは公開された順番として0からVideoCount-1まで重複なく連番になっていることを前提にしている
+package library
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// Entry ドキュメントのIDを付けた動画
+type Entry struct {
+	// DocID FirestoreのドキュメントID
+	// 通常は動画IDと同じ
+	DocID string
+	Video
+}
+
+type IssueKind string
+
+const (
+	// IssueGap 連番に抜けがある
+	IssueGap IssueKind = "gap"
+	// IssueDuplicate 同じNumberを持つ動画が複数ある
+	IssueDuplicate IssueKind = "duplicate"
+	// IssueOrphan Numberが範囲外、もしくはドキュメントIDと動画IDが一致しない
+	IssueOrphan IssueKind = "orphan"
+	// IssueCount VideoStatisticsのVideoCountとドキュメント数が一致しない
+	IssueCount IssueKind = "count"
+)
+
+type Issue struct {
+	Kind    IssueKind
+	Number  int
+	DocIDs  []string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("[%v] %v", i.Kind, i.Message)
+}
+
+type Report struct {
+	VideoCount    int
+	DocumentCount int
+	Issues        []Issue
+}
+
+func (r Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Load すべての動画と統計を読み込む
+func Load(ctx context.Context, storeClient *firestore.Client) ([]Entry, Statistics, error) {
+	var statistics Statistics
+	metrics.CountFirestoreReads("library", 1)
+	snap, err := storeClient.Collection("Info").Doc("VideoStatistics").Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, statistics, err
+	}
+	if snap.Exists() {
+		snap.DataTo(&statistics)
+	}
+
+	videos := []Entry{}
+	iter := storeClient.Collection("Video").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, statistics, err
+		}
+
+		metrics.CountFirestoreReads("library", 1)
+		var v Video
+		err = doc.DataTo(&v)
+		if err != nil {
+			return nil, statistics, err
+		}
+
+		videos = append(videos, Entry{
+			DocID: doc.Ref.ID,
+			Video: v,
+		})
+	}
+
+	return videos, statistics, nil
+}
+
+// Check 動画の一覧とVideoCountから連番の整合性を検査する
+func Check(videos []Entry, videoCount int) Report {
+	report := Report{
+		VideoCount:    videoCount,
+		DocumentCount: len(videos),
+	}
+
+	if videoCount != len(videos) {
+		report.Issues = append(report.Issues, Issue{
+			Kind:    IssueCount,
+			Number:  -1,
+			Message: fmt.Sprintf("VideoCount is %v but %v documents exist", videoCount, len(videos)),
+		})
+	}
+
+	byNumber := map[int][]string{}
+	for _, v := range videos {
+		if v.DocID != v.ID {
+			report.Issues = append(report.Issues, Issue{
+				Kind:    IssueOrphan,
+				Number:  v.Number,
+				DocIDs:  []string{v.DocID},
+				Message: fmt.Sprintf("document %v has video id %q", v.DocID, v.ID),
+			})
+		}
+
+		if v.Number < 0 || v.Number >= videoCount {
+			report.Issues = append(report.Issues, Issue{
+				Kind:    IssueOrphan,
+				Number:  v.Number,
+				DocIDs:  []string{v.DocID},
+				Message: fmt.Sprintf("document %v has number %v out of range [0, %v)", v.DocID, v.Number, videoCount),
+			})
+			continue
+		}
+
+		byNumber[v.Number] = append(byNumber[v.Number], v.DocID)
+	}
+
+	gapStart := -1
+	for n := 0; n <= videoCount; n++ {
+		docIDs, ok := byNumber[n]
+		if n < videoCount && !ok {
+			if gapStart < 0 {
+				gapStart = n
+			}
+			continue
+		}
+
+		// 抜けは範囲でまとめて報告する
+		if gapStart >= 0 {
+			report.Issues = append(report.Issues, Issue{
+				Kind:    IssueGap,
+				Number:  gapStart,
+				Message: fmt.Sprintf("number %v-%v is missing", gapStart, n-1),
+			})
+			gapStart = -1
+		}
+
+		if len(docIDs) > 1 {
+			sort.Strings(docIDs)
+			report.Issues = append(report.Issues, Issue{
+				Kind:    IssueDuplicate,
+				Number:  n,
+				DocIDs:  docIDs,
+				Message: fmt.Sprintf("number %v is used by %v", n, docIDs),
+			})
+		}
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Number < report.Issues[j].Number
+	})
+
+	return report
+}
+
+type RenumberChange struct {
+	DocID string
+	Title string
+	From  int
+	To    int
+}
+
+// PlanRenumber 0から連番になるように振り直した場合の変更点を返す
+// byPublishedAtがfalseの場合は現在のNumberの順番を維持する
+// 同じ順位の動画は公開日時、ドキュメントIDの順に並べる
+func PlanRenumber(videos []Entry, byPublishedAt bool) []RenumberChange {
+	sorted := make([]Entry, len(videos))
+	copy(sorted, videos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !byPublishedAt && a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		if !a.PublishedAt.Equal(b.PublishedAt) {
+			return a.PublishedAt.Before(b.PublishedAt)
+		}
+		return a.DocID < b.DocID
+	})
+
+	changes := []RenumberChange{}
+	for i, v := range sorted {
+		if v.Number == i {
+			continue
+		}
+
+		changes = append(changes, RenumberChange{
+			DocID: v.DocID,
+			Title: v.Title,
+			From:  v.Number,
+			To:    i,
+		})
+	}
+
+	return changes
+}
+
+type ErrChanged struct{}
+
+func (ErrChanged) Error() string {
+	return "library was changed while renumbering"
+}
+
+// 1トランザクションで書き込めるのは500件まで、VideoStatisticsの分を空けておく
+const maxRenumberWrites = 499
+
+// ApplyRenumber PlanRenumberの結果をlockのリースを確認しながら書き込み、VideoCountをドキュメント数に合わせる
+// lockはyoutube.ExportVideosと同じexport-videoのロックを渡す
+// 計画を作成した時点からVideoCountが変わっている場合は、トランザクションごとに確認して書き込みを止める
+// 途中で失敗した場合はそこまでの変更が残るので、もう一度計画を作成して振り直す
+func ApplyRenumber(ctx context.Context, lock *lease.Lock, storeClient *firestore.Client, changes []RenumberChange, expectVideoCount, documentCount int) error {
+	statisticsDoc := storeClient.Collection("Info").Doc("VideoStatistics")
+	collection := storeClient.Collection("Video")
+	for start := 0; start == 0 || start < len(changes); start += maxRenumberWrites {
+		end := start + maxRenumberWrites
+		if end > len(changes) {
+			end = len(changes)
+		}
+		last := end == len(changes)
+
+		err := lock.RunFenced(ctx, func(tx *firestore.Transaction) error {
+			metrics.CountFirestoreReads("statistics", 1)
+			snap, err := tx.Get(statisticsDoc)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+			var statistics Statistics
+			if snap.Exists() {
+				snap.DataTo(&statistics)
+			}
+			if statistics.VideoCount != expectVideoCount {
+				return ErrChanged{}
+			}
+
+			for _, c := range changes[start:end] {
+				err = tx.Update(collection.Doc(c.DocID), []firestore.Update{
+					{Path: "number", Value: c.To},
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if !last || statistics.VideoCount == documentCount {
+				return nil
+			}
+			statistics.VideoCount = documentCount
+			return tx.Set(statisticsDoc, statistics)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testEntry(id string, number int, publishedAt time.Time) Entry {
+	return Entry{
+		DocID: id,
+		Video: Video{
+			ID:          id,
+			Title:       "title " + id,
+			PublishedAt: publishedAt,
+			Duration:    time.Minute,
+			Number:      number,
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	orphan := testEntry("d", 3, base)
+	orphan.DocID = "other"
+
+	type issue struct {
+		Kind   IssueKind
+		Number int
+	}
+	tests := []struct {
+		name       string
+		videos     []Entry
+		videoCount int
+		want       []issue
+	}{
+		{
+			name:       "ok",
+			videos:     []Entry{testEntry("a", 0, base), testEntry("b", 1, base), testEntry("c", 2, base)},
+			videoCount: 3,
+		},
+		{
+			name:       "empty",
+			videoCount: 0,
+		},
+		{
+			name:       "gap",
+			videos:     []Entry{testEntry("a", 0, base), testEntry("b", 3, base)},
+			videoCount: 4,
+			want:       []issue{{IssueCount, -1}, {IssueGap, 1}},
+		},
+		{
+			name:       "gaps are reported separately",
+			videos:     []Entry{testEntry("a", 1, base), testEntry("b", 3, base)},
+			videoCount: 4,
+			want:       []issue{{IssueCount, -1}, {IssueGap, 0}, {IssueGap, 2}},
+		},
+		{
+			name:       "duplicate",
+			videos:     []Entry{testEntry("a", 0, base), testEntry("b", 1, base), testEntry("c", 1, base)},
+			videoCount: 3,
+			want:       []issue{{IssueDuplicate, 1}, {IssueGap, 2}},
+		},
+		{
+			name:       "out of range",
+			videos:     []Entry{testEntry("a", 0, base), testEntry("b", 1, base), testEntry("c", 5, base)},
+			videoCount: 3,
+			want:       []issue{{IssueGap, 2}, {IssueOrphan, 5}},
+		},
+		{
+			name:       "negative number",
+			videos:     []Entry{testEntry("a", -1, base), testEntry("b", 0, base)},
+			videoCount: 2,
+			want:       []issue{{IssueOrphan, -1}, {IssueGap, 1}},
+		},
+		{
+			name:       "document id mismatch",
+			videos:     []Entry{testEntry("a", 0, base), testEntry("b", 1, base), testEntry("c", 2, base), orphan},
+			videoCount: 4,
+			want:       []issue{{IssueOrphan, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		report := Check(tt.videos, tt.videoCount)
+		var got []issue
+		for _, i := range report.Issues {
+			got = append(got, issue{i.Kind, i.Number})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: issues = %v, want %v", tt.name, got, tt.want)
+		}
+		if report.OK() != (len(tt.want) == 0) {
+			t.Errorf("%v: OK() = %v", tt.name, report.OK())
+		}
+		if report.DocumentCount != len(tt.videos) {
+			t.Errorf("%v: DocumentCount = %v, want %v", tt.name, report.DocumentCount, len(tt.videos))
+		}
+	}
+}
+
+func TestPlanRenumber(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	type change struct {
+		DocID    string
+		From, To int
+	}
+	tests := []struct {
+		name          string
+		videos        []Entry
+		byPublishedAt bool
+		want          []change
+	}{
+		{
+			name:   "already numbered",
+			videos: []Entry{testEntry("a", 0, day(1)), testEntry("b", 1, day(2))},
+		},
+		{
+			name:   "close gaps keeping the order",
+			videos: []Entry{testEntry("a", 0, day(3)), testEntry("b", 2, day(1)), testEntry("c", 5, day(2))},
+			want:   []change{{"b", 2, 1}, {"c", 5, 2}},
+		},
+		{
+			name:   "duplicates are ordered by published date then document id",
+			videos: []Entry{testEntry("c", 1, day(2)), testEntry("b", 1, day(2)), testEntry("a", 1, day(1)), testEntry("d", 0, day(3))},
+			want:   []change{{"b", 1, 2}, {"c", 1, 3}},
+		},
+		{
+			name:          "by published date",
+			videos:        []Entry{testEntry("a", 0, day(3)), testEntry("b", 1, day(1)), testEntry("c", 2, day(2))},
+			byPublishedAt: true,
+			want:          []change{{"b", 1, 0}, {"c", 2, 1}, {"a", 0, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		var got []change
+		for _, c := range PlanRenumber(tt.videos, tt.byPublishedAt) {
+			got = append(got, change{c.DocID, c.From, c.To})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: changes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,18 @@
-package main
+package library
 
-import "time"
+import (
+	"time"
+)
 
-type videoStatistics struct {
+// Statistics Info/VideoStatisticsに保存する
+type Statistics struct {
 	LatestVideoID          string    `firestore:"latestVideoID"`
 	LatestVideoPublishedAt time.Time `firestore:"latestVideoPublishedAt"`
 	VideoCount             int       ` firestore:"videoCount"`
 }
 
-type videoInfo struct {
+// Video Videoコレクションに保存する動画
+type Video struct {
 	ID          string        `firestore:"id"`
 	Title       string        `firestore:"title"`
 	PublishedAt time.Time     `firestore:"publishedAt"`
@@ -17,16 +21,3 @@ type videoInfo struct {
 	// ランダムに取得する際にこの値でオーダーしてカーソルを使う
 	Number int `firestore:"number"`
 }
-
-type videoInfoPart struct {
-	ID          string    `firestore:"id"`
-	Title       string    `firestore:"title"`
-	PublishedAt time.Time `firestore:"publishedAt"`
-}
-
-type scheduleForStore struct {
-	Channel1 []byte `firestore:"channel1"`
-	Channel2 []byte `firestore:"channel2"`
-	Channel3 []byte `firestore:"channel3"`
-	Channel4 []byte `firestore:"channel4"`
-}
@@ -0,0 +1,92 @@
+// ソースとして登録したプレイリスト
+// 他のチャンネルの動画も含まれるので、Videoコレクションとは別にプレイリストごとに順番と長さを保存する
+package library
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// PlaylistItem プレイリストの動画、長さが決まっていない動画は含まない
+type PlaylistItem struct {
+	VideoID     string        `firestore:"videoId" json:"videoId"`
+	Title       string        `firestore:"title" json:"title"`
+	PublishedAt time.Time     `firestore:"publishedAt" json:"publishedAt"`
+	Duration    time.Duration `firestore:"duration" json:"duration"`
+}
+
+// Playlist プレイリストの動画をプレイリストの順番に並べたもの
+type Playlist struct {
+	ID        string         `firestore:"id" json:"id"`
+	Title     string         `firestore:"title" json:"title"`
+	Items     []PlaylistItem `firestore:"items" json:"items"`
+	UpdatedAt time.Time      `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// Position videoIDの動画のプレイリストでの位置、含まれない場合は-1
+func (p Playlist) Position(videoID string) int {
+	for i, it := range p.Items {
+		if it.VideoID == videoID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Entries インデックスと同じ形式に変換する
+func (p Playlist) Entries() []IndexEntry {
+	result := make([]IndexEntry, 0, len(p.Items))
+	for _, it := range p.Items {
+		result = append(result, IndexEntry{
+			ID:          it.VideoID,
+			Duration:    it.Duration,
+			PublishedAt: it.PublishedAt,
+		})
+	}
+
+	return result
+}
+
+func PlaylistDoc(storeClient *firestore.Client, id string) *firestore.DocumentRef {
+	return storeClient.Collection("Playlist").Doc(id)
+}
+
+// LoadPlaylists idsのプレイリストを読み込む
+// まだ取り込まれていないプレイリストは結果に含まれない
+func LoadPlaylists(ctx context.Context, storeClient *firestore.Client, ids []string) (map[string]Playlist, error) {
+	result := make(map[string]Playlist, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, PlaylistDoc(storeClient, id))
+	}
+
+	metrics.CountFirestoreReads("playlist", len(refs))
+	snaps, err := storeClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+
+		var p Playlist
+		err = snap.DataTo(&p)
+		if err != nil {
+			return nil, err
+		}
+		result[p.ID] = p
+	}
+
+	return result, nil
+}
@@ -0,0 +1,307 @@
+// タイトルの「#1」「第2回」「Part 3」などから見つけたシリーズ
+// 全動画のタイトルが必要なので、インデックスと同じように1つのドキュメントにまとめて保存しておく
+package library
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// Episode シリーズの1話分
+type Episode struct {
+	VideoID  string        `firestore:"videoId" json:"videoId"`
+	Number   int           `firestore:"number" json:"number"`
+	Duration time.Duration `firestore:"duration" json:"duration"`
+}
+
+// Series 話数の順に並べたシリーズ
+type Series struct {
+	// ID タイトルから見つけた場合はtitle:、プレイリストの場合はplaylist:で始まる
+	ID       string    `firestore:"id" json:"id"`
+	Title    string    `firestore:"title" json:"title"`
+	Episodes []Episode `firestore:"episodes" json:"episodes"`
+}
+
+// seriesCandidate タイトルから話数が見つかった動画
+// 後から続きが追加されたときにまとめられるように、1話しかないものも保存しておく
+type seriesCandidate struct {
+	Name        string        `firestore:"name"`
+	VideoID     string        `firestore:"videoId"`
+	Number      int           `firestore:"number"`
+	Duration    time.Duration `firestore:"duration"`
+	PublishedAt time.Time     `firestore:"publishedAt"`
+}
+
+// seriesForStore Info/Seriesに保存する形式
+type seriesForStore struct {
+	// VideoCount 候補に取り込んだときのVideoCount、増えている場合は追加された動画だけを取り込む
+	VideoCount int               `firestore:"videoCount"`
+	Candidates []seriesCandidate `firestore:"candidates"`
+	UpdatedAt  time.Time         `firestore:"updatedAt"`
+}
+
+// episodePatterns 話数の書き方、最初に見つかったものを使う
+// 括弧だけの数字は年や人数のこともあるので、タイトルの末尾にある場合だけ話数とする
+var episodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[#＃]\s*(\d{1,3})`),
+	regexp.MustCompile(`第\s*(\d{1,3})\s*[回話弾部夜]`),
+	regexp.MustCompile(`(?i)\bpart\.?\s*(\d{1,3})`),
+	regexp.MustCompile(`その\s*(\d{1,3})`),
+	regexp.MustCompile(`[(（]\s*(\d{1,3})\s*[)）]\s*$`),
+}
+
+// seriesNameTrim 話数を取り除いた後にシリーズ名の前後から取り除く文字
+const seriesNameTrim = " 　-–—|｜:：/／・,、"
+
+// toHalfWidthDigit 全角の数字を半角にする
+func toHalfWidthDigit(r rune) rune {
+	if r >= '０' && r <= '９' {
+		return r - '０' + '0'
+	}
+	return r
+}
+
+// ParseEpisode タイトルからシリーズ名と話数を取り出す
+// 話数が見つからない、もしくは話数を除くと何も残らない場合はfalseを返す
+func ParseEpisode(title string) (string, int, bool) {
+	normalized := strings.Map(toHalfWidthDigit, title)
+	for _, p := range episodePatterns {
+		m := p.FindStringSubmatchIndex(normalized)
+		if m == nil {
+			continue
+		}
+
+		number, err := strconv.Atoi(normalized[m[2]:m[3]])
+		if err != nil {
+			continue
+		}
+
+		name := strings.Trim(normalized[:m[0]]+" "+normalized[m[1]:], seriesNameTrim)
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" {
+			return "", 0, false
+		}
+
+		return name, number, true
+	}
+
+	return "", 0, false
+}
+
+// FindSeries 動画のタイトルからシリーズを見つける
+// 2話以上あるものだけをシリーズとする
+func FindSeries(videos []Video) []Series {
+	return groupSeries(parseCandidates(videos))
+}
+
+// parseCandidates タイトルから話数が見つかった動画を取り出す
+func parseCandidates(videos []Video) []seriesCandidate {
+	result := []seriesCandidate{}
+	for _, v := range videos {
+		if v.Duration <= 0 {
+			continue
+		}
+
+		name, number, ok := ParseEpisode(v.Title)
+		if !ok {
+			continue
+		}
+
+		result = append(result, seriesCandidate{
+			Name:        name,
+			VideoID:     v.ID,
+			Number:      number,
+			Duration:    v.Duration,
+			PublishedAt: v.PublishedAt,
+		})
+	}
+
+	return result
+}
+
+// groupSeries 同じシリーズ名の候補を話数の順に並べてシリーズにする
+func groupSeries(candidates []seriesCandidate) []Series {
+	byName := map[string][]seriesCandidate{}
+	titles := map[string]string{}
+	for _, c := range candidates {
+		key := strings.ToLower(c.Name)
+		if _, ok := titles[key]; !ok {
+			titles[key] = c.Name
+		}
+		byName[key] = append(byName[key], c)
+	}
+
+	result := []Series{}
+	for key, episodes := range byName {
+		if len(episodes) < 2 {
+			continue
+		}
+
+		// 同じ話数が複数ある場合は公開された順にする
+		sort.Slice(episodes, func(i, j int) bool {
+			if episodes[i].Number != episodes[j].Number {
+				return episodes[i].Number < episodes[j].Number
+			}
+			return episodes[i].PublishedAt.Before(episodes[j].PublishedAt)
+		})
+
+		s := Series{
+			ID:       "title:" + key,
+			Title:    titles[key],
+			Episodes: make([]Episode, 0, len(episodes)),
+		}
+		for _, e := range episodes {
+			s.Episodes = append(s.Episodes, Episode{
+				VideoID:  e.VideoID,
+				Number:   e.Number,
+				Duration: e.Duration,
+			})
+		}
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// PlaylistSeries プレイリストの順番をそのまま話数としたシリーズ
+func PlaylistSeries(p Playlist) Series {
+	s := Series{
+		ID:    "playlist:" + p.ID,
+		Title: p.Title,
+	}
+	for i, it := range p.Items {
+		if it.Duration <= 0 {
+			continue
+		}
+		s.Episodes = append(s.Episodes, Episode{
+			VideoID:  it.VideoID,
+			Number:   i + 1,
+			Duration: it.Duration,
+		})
+	}
+
+	return s
+}
+
+func seriesDoc(storeClient *firestore.Client) *firestore.DocumentRef {
+	return storeClient.Collection("Info").Doc("Series")
+}
+
+// LoadSeries タイトルから見つけたシリーズを読み込む
+// 動画が追加されている場合は追加された動画だけを読み込んで候補に加え、保存されていない場合は作り直す
+func LoadSeries(ctx context.Context, storeClient *firestore.Client) ([]Series, error) {
+	metrics.CountFirestoreReads("series", 2)
+	snap, err := storeClient.Collection("Info").Doc("VideoStatistics").Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrStatisticsNotExists{}
+		}
+		return nil, err
+	}
+	var statistics Statistics
+	snap.DataTo(&statistics)
+
+	snap, err = seriesDoc(storeClient).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	if snap.Exists() {
+		var s seriesForStore
+		err = snap.DataTo(&s)
+		if err == nil && s.VideoCount == statistics.VideoCount {
+			return groupSeries(s.Candidates), nil
+		}
+		// 番号の振り直しなどで減っている場合は追加された動画が分からないので作り直す
+		if err == nil && s.VideoCount < statistics.VideoCount {
+			return appendSeries(ctx, storeClient, s, statistics.VideoCount)
+		}
+	}
+
+	logging.Info(ctx, "rebuild series", logging.Fields{
+		"videoCount": statistics.VideoCount,
+	})
+	return RebuildSeries(ctx, storeClient)
+}
+
+// appendSeries 保存されている候補のVideoCount以降に追加された動画だけを読み込んで候補に加える
+func appendSeries(ctx context.Context, storeClient *firestore.Client, s seriesForStore, videoCount int) ([]Series, error) {
+	iter := storeClient.Collection("Video").Where("number", ">=", s.VideoCount).Documents(ctx)
+	defer iter.Stop()
+
+	var videos []Video
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		metrics.CountFirestoreReads("series", 1)
+		var v Video
+		err = doc.DataTo(&v)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, v)
+	}
+
+	seen := make(map[string]struct{}, len(s.Candidates))
+	for _, c := range s.Candidates {
+		seen[c.VideoID] = struct{}{}
+	}
+	for _, c := range parseCandidates(videos) {
+		if _, ok := seen[c.VideoID]; ok {
+			continue
+		}
+		s.Candidates = append(s.Candidates, c)
+	}
+
+	return saveSeries(ctx, storeClient, videoCount, s.Candidates)
+}
+
+// RebuildSeries Videoコレクションからシリーズを見つけ直して保存する
+func RebuildSeries(ctx context.Context, storeClient *firestore.Client) ([]Series, error) {
+	entries, statistics, err := Load(ctx, storeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	videos := make([]Video, 0, len(entries))
+	for _, e := range entries {
+		videos = append(videos, e.Video)
+	}
+
+	return saveSeries(ctx, storeClient, statistics.VideoCount, parseCandidates(videos))
+}
+
+// saveSeries 候補を保存してシリーズにまとめる
+func saveSeries(ctx context.Context, storeClient *firestore.Client, videoCount int, candidates []seriesCandidate) ([]Series, error) {
+	_, err := seriesDoc(storeClient).Set(ctx, seriesForStore{
+		VideoCount: videoCount,
+		Candidates: candidates,
+		UpdatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return groupSeries(candidates), nil
+}
@@ -0,0 +1,102 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		title  string
+		name   string
+		number int
+		ok     bool
+	}{
+		{"マイクラ実況 #1", "マイクラ実況", 1, true},
+		{"#12 マイクラ実況", "マイクラ実況", 12, true},
+		{"マイクラ実況 ＃ ３", "マイクラ実況", 3, true},
+		{"マイクラ実況 第3回", "マイクラ実況", 3, true},
+		{"【ホラー】第 10 夜 廃病院", "【ホラー】 廃病院", 10, true},
+		{"Minecraft Part 2", "Minecraft", 2, true},
+		{"Minecraft part.5 - the end", "Minecraft - the end", 5, true},
+		{"雑談その4", "雑談", 4, true},
+		{"お絵かき (2)", "お絵かき", 2, true},
+		{"お絵かき（１２）", "お絵かき", 12, true},
+		{"お絵かき (2) ", "お絵かき", 2, true},
+		// 最初に見つかった書き方を使う
+		{"第2回 お絵かき #5", "第2回 お絵かき", 5, true},
+		// 話数だけのタイトル
+		{"#1", "", 0, false},
+		{"第1回", "", 0, false},
+		// 話数ではない
+		{"お絵かき", "", 0, false},
+		{"2020年の振り返り", "", 0, false},
+		{"(3)人でコラボ", "", 0, false},
+		{"コラボ (2020) 振り返り", "", 0, false},
+		{"お絵かき (1234)", "", 0, false},
+		{"Departure 3", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		name, number, ok := ParseEpisode(tt.title)
+		if name != tt.name || number != tt.number || ok != tt.ok {
+			t.Errorf("ParseEpisode(%q) = %q, %v, %v, want %q, %v, %v", tt.title, name, number, ok, tt.name, tt.number, tt.ok)
+		}
+	}
+}
+
+func TestFindSeries(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	videos := []Video{
+		{ID: "m2", Title: "マイクラ実況 #2", PublishedAt: day(2), Duration: time.Minute},
+		{ID: "m1", Title: "マイクラ実況 #1", PublishedAt: day(1), Duration: time.Minute},
+		// 大文字小文字が違っても同じシリーズ
+		{ID: "m3", Title: "マイクラ実況 PART 3", PublishedAt: day(3), Duration: time.Minute},
+		// 同じ話数は公開された順
+		{ID: "m3b", Title: "マイクラ実況 #3", PublishedAt: day(4), Duration: time.Minute},
+		// 長さが取得できていない動画は入れない
+		{ID: "m4", Title: "マイクラ実況 #4", PublishedAt: day(5), Duration: 0},
+		// 1話しかない
+		{ID: "h1", Title: "ホラー #1", PublishedAt: day(1), Duration: time.Minute},
+		{ID: "x", Title: "雑談", PublishedAt: day(1), Duration: time.Minute},
+	}
+
+	got := FindSeries(videos)
+	want := []Series{
+		{
+			ID:    "title:マイクラ実況",
+			Title: "マイクラ実況",
+			Episodes: []Episode{
+				{VideoID: "m1", Number: 1, Duration: time.Minute},
+				{VideoID: "m2", Number: 2, Duration: time.Minute},
+				{VideoID: "m3", Number: 3, Duration: time.Minute},
+				{VideoID: "m3b", Number: 3, Duration: time.Minute},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindSeries = %+v, want %+v", got, want)
+	}
+}
+
+func TestGroupSeriesAppendedCandidates(t *testing.T) {
+	// 1話しかなかった候補に、後から追加された動画の続きがまとまる
+	stored := parseCandidates([]Video{
+		{ID: "h1", Title: "ホラー #1", Duration: time.Minute},
+		{ID: "x", Title: "雑談", Duration: time.Minute},
+	})
+	if len(groupSeries(stored)) != 0 {
+		t.Fatalf("single episode should not be a series")
+	}
+
+	added := parseCandidates([]Video{
+		{ID: "h2", Title: "ホラー #2", Duration: time.Minute},
+	})
+	got := groupSeries(append(stored, added...))
+	if len(got) != 1 || len(got[0].Episodes) != 2 || got[0].Episodes[0].VideoID != "h1" || got[0].Episodes[1].VideoID != "h2" {
+		t.Errorf("groupSeries = %+v, want h1 and h2", got)
+	}
+}
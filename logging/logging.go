@@ -0,0 +1,113 @@
+// JSON形式の構造化ログ
+// Cloud Loggingが解釈できるようにseverityとmessageを1行のJSONで出力する
+// リクエストIDとジョブの実行IDはコンテキストから取得して付与する
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Fields ログに付け加える値
+type Fields map[string]interface{}
+
+type logSeverity string
+
+const (
+	severityInfo    logSeverity = "INFO"
+	severityWarning logSeverity = "WARNING"
+	severityError   logSeverity = "ERROR"
+)
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "requestID"
+	jobRunIDKey  contextKey = "jobRunID"
+)
+
+var logMu sync.Mutex
+
+// WithRequestID リクエストのIDをコンテキストに設定する
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID リクエストのIDを返す、リクエスト外の場合は空
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithJobRunID ジョブの実行IDをコンテキストに設定する
+func WithJobRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, jobRunIDKey, id)
+}
+
+func JobRunID(ctx context.Context) string {
+	id, _ := ctx.Value(jobRunIDKey).(string)
+	return id
+}
+
+// NewID リクエストやジョブの実行を識別するためのランダムなID
+func NewID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func writeLog(ctx context.Context, severity logSeverity, message string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+5)
+	for k, v := range fields {
+		// errorはそのままだとJSONにしたときに空になる
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["severity"] = severity
+	entry["message"] = message
+	if ctx != nil {
+		if id, ok := ctx.Value(requestIDKey).(string); ok {
+			entry["requestId"] = id
+		}
+		if id, ok := ctx.Value(jobRunIDKey).(string); ok {
+			entry["jobRunId"] = id
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"severity":"ERROR","message":%q}`, "can not marshal log: "+err.Error()))
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+	os.Stdout.Write(append(line, '\n'))
+}
+
+// Info 構造化されたログを標準出力に出力する
+// Cloud Loggingではseverityで絞り込める
+func Info(ctx context.Context, message string, fields Fields) {
+	writeLog(ctx, severityInfo, message, fields)
+}
+
+func Warning(ctx context.Context, message string, fields Fields) {
+	writeLog(ctx, severityWarning, message, fields)
+}
+
+func Error(ctx context.Context, message string, fields Fields) {
+	writeLog(ctx, severityError, message, fields)
+}
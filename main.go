@@ -1,65 +1,115 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"context"
 	"os"
 	"time"
 
-	"github.com/labstack/echo/v4"
+	"github.com/yaegaki/ohohoi-bank/api"
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/cli"
+	"github.com/yaegaki/ohohoi-bank/config"
+	"github.com/yaegaki/ohohoi-bank/job"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/schedule"
+	"github.com/yaegaki/ohohoi-bank/store"
 )
 
-func scheduleHandler(c echo.Context) error {
-	ctx := c.Request().Context()
-
-	now := time.Now().In(jst)
-	today := truncateHour(now)
-	tommorow := today.Add(24 * time.Hour)
-	client, err := createFirestoreClient(ctx)
+// applyConfig 設定をプロセス全体で使うものに反映して、各パッケージに渡す設定を作る
+// 各パッケージの設定の検査に失敗した場合はエラーを返して起動しない
+func applyConfig(c config.Config) (api.Options, error) {
+	loc, err := broadcast.LoadLocation(c.Scheduling.Timezone)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "error")
+		return api.Options{}, err
 	}
-	schedule, err := getSchedule(ctx, client, today)
+	offset, err := broadcast.ParseDayStart(c.Scheduling.DayStart)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "error")
+		return api.Options{}, err
 	}
-
-	tommorowSchedule, err := getSchedule(ctx, client, tommorow)
-	if err == nil {
-		schedule = schedule.merge(tommorowSchedule)
+	slot, err := broadcast.ParseDayStart(c.Series.Slot)
+	if err != nil {
+		return api.Options{}, err
 	}
+	broadcast.Location = loc
+	broadcast.DayStartOffset = offset
 
-	schedule = schedule.getPart(now, 3*time.Hour)
-	return c.JSON(http.StatusOK, schedule)
-}
+	// Firestoreのクライアントは環境変数でエミュレーターに接続する
+	if c.Storage.EmulatorHost != "" {
+		os.Setenv("FIRESTORE_EMULATOR_HOST", c.Storage.EmulatorHost)
+	}
+	store.ProjectID = c.Storage.ProjectID
 
-func exportHandler(c echo.Context) error {
-	ctx := c.Request().Context()
-	isDevelop := os.Getenv("DEVELOP") == "true"
+	scheduleOpts := schedule.Options{
+		ChannelCount:     len(c.Channels),
+		MaxVideoDuration: time.Duration(c.Scheduling.MaxVideoDuration),
+		PlaylistIDs:      c.Source.Playlists,
+		ChannelPlaylists: make([]string, len(c.Channels)),
+		LiveChannel:      c.Live.Channel - 1,
+		Series: schedule.SeriesOptions{
+			Mode:      c.Series.Mode,
+			BlockSize: c.Series.BlockSize,
+			Slot:      slot,
+			Channel:   c.Series.Channel - 1,
+		},
+	}
+	names := make([]string, len(c.Channels))
+	for i, ch := range c.Channels {
+		scheduleOpts.ChannelPlaylists[i] = ch.Playlist
+		names[i] = ch.Name
+	}
 
-	if !isDevelop && c.Request().Header.Get("X-Appengine-Cron") != "true" {
-		return c.String(http.StatusBadRequest, "bad request")
+	opts := api.Options{
+		Job: job.Options{
+			Scheduler:  c.Job.Scheduler,
+			ExportCron: c.Job.ExportCron,
+			LiveCron:   c.Live.Cron,
+			LiveHours:  c.Live.Hours,
+			ChannelID:  c.Source.ChannelID,
+			Schedule:   scheduleOpts,
+		},
+		ChannelNames:  names,
+		DefaultWindow: time.Duration(c.Window.Default),
+		MaxWindow:     time.Duration(c.Window.Max),
+		Config:        c,
+		Events:        c.Events.Enabled,
 	}
+	return opts, opts.Job.Validate()
+}
 
-	log.Println("export task start")
-	err := exportJob(ctx)
+// setupConfig 設定を読み込んで反映する
+func setupConfig(path string) (api.Options, error) {
+	c, err := config.Load(path)
 	if err != nil {
-		return err
+		return api.Options{}, err
 	}
 
-	return c.String(http.StatusOK, "done.")
+	return applyConfig(c)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], setupConfig))
+	}
+
+	opts, err := setupConfig("")
+	if err != nil {
+		logging.Error(context.Background(), "Can't load config", logging.Fields{
+			"error": err,
+		})
+		os.Exit(1)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	e := echo.New()
-	e.GET("/schedule", scheduleHandler)
-	e.GET("/_task/export", exportHandler)
-	e.Static("/", "public")
+	e := api.NewServer(opts)
+	api.StartEventWatchers(context.Background(), opts)
+	err = job.StartScheduler(context.Background(), opts.Job)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
 
 	e.Logger.Fatal(e.Start(":" + port))
 }
@@ -0,0 +1,83 @@
+// Prometheusのメトリクス
+// /metricsで公開する
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	VideosIngested = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "siro4_videos_ingested_total",
+		Help: "Number of videos exported from YouTube to the library.",
+	})
+	VideosRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_videos_rejected_total",
+		Help: "Number of videos not exported because their duration can't be scheduled.",
+	}, []string{"reason"})
+	VideosPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "siro4_videos_pending",
+		Help: "Number of live streams, premieres and unprocessed videos waiting to be exported.",
+	})
+	FirestoreReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_firestore_reads_total",
+		Help: "Number of Firestore document reads.",
+	}, []string{"target"})
+	YoutubeCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_youtube_api_calls_total",
+		Help: "Number of YouTube Data API calls.",
+	}, []string{"method"})
+	YoutubeQuota = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_youtube_quota_units_total",
+		Help: "YouTube Data API quota units consumed.",
+	}, []string{"method"})
+	SchedulerRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_scheduler_rejections_total",
+		Help: "Number of candidate videos, channels or schedules rejected by the scheduler.",
+	}, []string{"reason"})
+	ScheduleGeneration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "siro4_schedule_generation_seconds",
+		Help:    "Time taken to generate a day's schedule.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	ExportJobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_export_job_runs_total",
+		Help: "Number of export job runs by result.",
+	}, []string{"result"})
+	ExportJobDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "siro4_export_job_duration_seconds",
+		Help:    "Time taken by the export job.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "siro4_http_requests_total",
+		Help: "Number of HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "siro4_http_request_duration_seconds",
+		Help:    "HTTP request latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		VideosIngested,
+		VideosRejected,
+		VideosPending,
+		FirestoreReads,
+		YoutubeCalls,
+		YoutubeQuota,
+		SchedulerRejections,
+		ScheduleGeneration,
+		ExportJobRuns,
+		ExportJobDuration,
+		HTTPRequests,
+		HTTPDuration,
+	)
+}
+
+// CountFirestoreReads targetのドキュメントをn件読み込んだことを記録する
+func CountFirestoreReads(target string, n int) {
+	FirestoreReads.WithLabelValues(target).Add(float64(n))
+}
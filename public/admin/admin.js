@@ -0,0 +1,91 @@
+(() => {
+    const tokenKey = 'siro4-admin-token';
+
+    const formatTime = t => {
+        const d = new Date(t);
+        // ゼロ値の時刻は未設定として扱う
+        if (d.getUTCFullYear() <= 1) {
+            return '-';
+        }
+        return d.toLocaleString();
+    };
+
+    const formatDuration = (start, end) => {
+        const ms = new Date(end) - new Date(start);
+        if (!(ms >= 0)) {
+            return '-';
+        }
+        return (ms / 1000).toFixed(1) + 's';
+    };
+
+    const cell = (text, className) => {
+        const td = document.createElement('td');
+        td.textContent = text;
+        if (className) {
+            td.className = className;
+        }
+        return td;
+    };
+
+    const fetchJobs = async () => {
+        const headers = {};
+        const token = localStorage.getItem(tokenKey);
+        if (token) {
+            headers['Authorization'] = 'Bearer ' + token;
+        }
+
+        const res = await fetch('/admin/api/jobs', { headers });
+        if (res.status === 401 || res.status === 403) {
+            const t = prompt('Admin token');
+            if (t === null) {
+                throw new Error('forbidden');
+            }
+            localStorage.setItem(tokenKey, t);
+            return fetchJobs();
+        }
+        if (!res.ok) {
+            throw new Error('failed to fetch jobs: ' + res.status);
+        }
+        return res.json();
+    };
+
+    const render = jobs => {
+        const status = document.getElementById('status');
+        status.innerHTML = '';
+        const lines = [
+            ['Last run', formatTime(jobs.status.lastRunAt) + ' (' + (jobs.status.lastResult || '-') + ')'],
+            ['Last success', formatTime(jobs.status.lastSuccessAt)],
+            ['Last ingestion', formatTime(jobs.status.lastIngestionAt)],
+        ];
+        for (const [label, value] of lines) {
+            const p = document.createElement('p');
+            p.textContent = label + ': ' + value;
+            status.appendChild(p);
+        }
+        if (jobs.stale) {
+            const p = document.createElement('p');
+            p.className = 'stale';
+            p.textContent = 'The export job has not succeeded recently. Check the cron.';
+            status.appendChild(p);
+        }
+
+        const tbody = document.getElementById('runs');
+        tbody.innerHTML = '';
+        for (const run of jobs.runs) {
+            const tr = document.createElement('tr');
+            tr.appendChild(cell(formatTime(run.startedAt)));
+            tr.appendChild(cell(run.result, run.result));
+            tr.appendChild(cell(formatDuration(run.startedAt, run.finishedAt)));
+            tr.appendChild(cell((run.phases || []).map(p => p.name + ' ' + formatDuration(p.startedAt, p.finishedAt) + (p.error ? ' (error)' : '')).join(', ')));
+            tr.appendChild(cell(run.videosIngested));
+            tr.appendChild(cell(run.quotaUsed));
+            tr.appendChild(cell((run.scheduleDates || []).join(', ')));
+            tr.appendChild(cell(run.error || ''));
+            tbody.appendChild(tr);
+        }
+    };
+
+    fetchJobs().then(render).catch(e => {
+        document.getElementById('status').textContent = e.message;
+    });
+})();
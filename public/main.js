@@ -9,8 +9,15 @@
         watch();
     });
 
+    // サーバーの時計とのずれ(ミリ秒)
+    // 端末の時計がずれていてもサーバーの時計に合わせて再生する
+    let clockOffset = 0;
+    // /eventsで通知を受け取れるか
+    let eventsAvailable = true;
+
     // watchボタンを押す前からスケジュールの取得とyoutubeIFrameAPIの準備はしておく
     const schedulePromise = fetchSchedule();
+    const clockPromise = syncClock().catch(e => console.log(e));
 
     const youtubeReadyPromise = new Promise(resolve => {
         var tag = document.createElement('script');
@@ -28,16 +35,19 @@
     });
 
     async function fetchSchedule() {
-        const res = await fetch("/schedule");
+        // 配信の開始と終了を反映するため、キャッシュを使う場合もサーバーに確認する
+        const res = await fetch("/api/v1/schedule", { cache: 'no-cache' });
         const rawSchedule = await res.json();
         return {
-            channels: rawSchedule.Channels.map(c => {
+            channels: rawSchedule.channels.map(c => {
                 return {
-                    items: c.Items.map(i => {
+                    items: c.items.map(i => {
                         return {
-                            time: parseDate(i.Time),
-                            duration: i.Duration /  1000000000,
-                            videoId: i.VideoID,
+                            time: parseDate(i.start),
+                            duration: i.durationSeconds,
+                            videoId: i.videoId,
+                            // ライブ配信の同時放送、終了時刻は決まっていない
+                            live: i.live === true,
                         };
                     }),
                 };
@@ -45,6 +55,16 @@
         };
     }
 
+    async function syncClock() {
+        const start = Date.now();
+        const res = await fetch("/api/v1/now");
+        const now = await res.json();
+        const end = Date.now();
+        // 通信にかかった時間の半分だけ進めたものをサーバーの現在時刻とみなす
+        clockOffset = Date.parse(now.serverTime) + (end - start) / 2 - end;
+        console.log(`clock offset: ${clockOffset}ms`);
+    }
+
     function sleep(time) {
         return new Promise(resolve => setTimeout(resolve, time));
     }
@@ -52,24 +72,85 @@
     async function watch() {
         await youtubeReadyPromise;
         const schedule = await schedulePromise;
+        await clockPromise;
         console.log(schedule);
 
         const players = ['player1', 'player2', 'player3', 'player4'].map((p, i) => createPlayer(p, schedule, i));
 
         // スケジュールを1時間に一度取得する
         updateScheduleTask(players);
+        // スケジュールの更新と番組の切り替わりはサーバーから通知される
+        connectEvents(players);
+    }
+
+    function connectEvents(players) {
+        // 切断された場合はEventSourceが自動で再接続する
+        const source = new EventSource('/events');
+
+        // サーバーで無効になっている場合(204)は再接続しないので定期的な取得に切り替える
+        source.addEventListener('error', () => {
+            if (source.readyState === EventSource.CLOSED) {
+                eventsAvailable = false;
+                console.log('events are not available, fallback to polling.');
+            }
+        });
+
+        source.addEventListener('schedule', async e => {
+            console.log(`schedule updated: ${JSON.parse(e.data).date}`);
+            try {
+                const newSchedule = await fetchSchedule();
+                players.forEach(p => p.applySchedule(newSchedule));
+            }
+            catch (err) {
+                console.log(err);
+            }
+        });
+
+        source.addEventListener('switch', async e => {
+            const data = JSON.parse(e.data);
+            // idは1から
+            const player = players[data.id - 1];
+            if (player == null || data.current == null) return;
+
+            // 配信の開始と終了はスケジュールを取得し直して反映する
+            if (data.current.live || player.isLive()) {
+                try {
+                    const newSchedule = await fetchSchedule();
+                    players.forEach(p => p.applySchedule(newSchedule));
+                }
+                catch (err) {
+                    console.log(err);
+                }
+                if (data.current.live) return;
+            }
+            player.switchTo(data.current.videoId);
+        });
+
+        source.addEventListener('heartbeat', e => {
+            const data = JSON.parse(e.data);
+            // 通信の遅延分ずれるので/nowで同期した値から大きくずれている場合だけ補正する
+            const offset = Date.parse(data.serverTime) - Date.now();
+            if (Math.abs(offset - clockOffset) > 2000) {
+                clockOffset = offset;
+                console.log(`clock offset: ${clockOffset}ms`);
+            }
+        });
     }
 
     async function updateScheduleTask(players) {
         const hour = 1000 * 60 * 60;
+        // イベントが届かない場合と配信中は、配信の開始と終了に気づけるように1分ごとに取得する
+        const pollInterval = 1000 * 60;
         let interval = hour;
         while (true) {
-            await sleep(interval);
+            const polling = !eventsAvailable || players.some(p => p.isLive());
+            await sleep(polling ? Math.min(interval, pollInterval) : interval);
             try {
                 const newSchedule = await fetchSchedule();
                 console.log('update schedule.');
                 console.log(newSchedule);
                 players.forEach(p => p.applySchedule(newSchedule));
+                await syncClock();
                 interval = hour;
             }
             catch {
@@ -81,6 +162,8 @@
 
     function createPlayer(elemId, schedule, channelId) {
         let currentVideoInfo = getVideoAndOffset(schedule.channels[channelId], getNowDate());
+        // 同時放送中の配信のID
+        let liveVideoId = currentVideoInfo.video.live ? currentVideoInfo.video.videoId : null;
 
         const ytPlayer = new YT.Player(elemId, {
             height: '360',
@@ -91,7 +174,7 @@
                 cc_load_policy: 0,
                 disablekb: 0,
                 fs: 0,
-                start: currentVideoInfo.offset,
+                start: liveVideoId == null ? currentVideoInfo.offset : undefined,
                 playsinline: 1,
             },
             events: {
@@ -105,6 +188,43 @@
             ytPlayer,
             applySchedule(newSchedule) {
                 schedule = newSchedule;
+                player.updateLive();
+            },
+            // 配信中かどうかはスケジュールの現在の番組で決める
+            // 配信が終わったスケジュールを取得したら予定の番組に戻る
+            updateLive() {
+                const info = getVideoAndOffset(schedule.channels[channelId], getNowDate());
+                if (info.video.live) {
+                    player.goLive(info.video.videoId);
+                }
+                else if (liveVideoId != null) {
+                    player.endLive();
+                }
+            },
+            isLive() {
+                return liveVideoId != null;
+            },
+            goLive(videoId) {
+                if (liveVideoId === videoId) return;
+
+                liveVideoId = videoId;
+                ytPlayer.loadVideoById(videoId);
+                console.log(`switch to live:${videoId}`);
+            },
+            endLive() {
+                liveVideoId = null;
+                console.log('end live');
+            },
+            switchTo(videoId) {
+                const videoData = ytPlayer.getVideoData();
+                if (videoData != null && videoData.video_id === videoId) return;
+
+                const info = getVideoAndOffset(schedule.channels[channelId], getNowDate());
+                if (info.video.videoId !== videoId) return;
+
+                currentVideoInfo = info;
+                ytPlayer.loadVideoById(info.video.videoId, info.offset);
+                console.log(`switch video to:${videoId}`);
             },
         };
 
@@ -126,7 +246,20 @@
                 const videoData = player.ytPlayer.getVideoData();
                 if (videoData == null) continue;
 
+                player.updateLive();
                 const currentVideoId = videoData.video_id;
+                // 配信中は経過時間に合わせずにそのまま再生する
+                if (liveVideoId != null) {
+                    if (currentVideoId !== liveVideoId) {
+                        player.ytPlayer.loadVideoById(liveVideoId);
+                    }
+                    else if (playerState === YT.PlayerState.PAUSED) {
+                        player.ytPlayer.playVideo();
+                    }
+                    syncTime = defaultSyncTime;
+                    continue;
+                }
+
                 currentVideoInfo = getVideoAndOffset(schedule.channels[channelId], getNowDate(), currentVideoId);
 
                 if (bufferCount >= 2 || currentVideoInfo.video.videoId !== currentVideoId) {
@@ -181,55 +314,30 @@
             }
         }
 
+        // 再生中の動画がスケジュールにない場合(配信が終わった場合など)は最初から探す
+        if (skip) {
+            return getVideoAndOffset(channel, date);
+        }
+
         return {
             video: channel.items[0],
             offset: 0,
         };
     }
 
+    // 時刻はRFC3339(UTC)で返ってくるのでそのまま解釈できる
+    // 以降は1970年からのミリ秒で扱う
     function parseDate(dateStr) {
-        const x = dateStr.split('T');
-        const [year, month, day] = x[0].split('-');
-
-        // 時間はjstで指定されていること前提
-        const [hours, minutes, seconds] = x[1].split('+')[0].split(':');
-        const p = s => parseInt(s, 10);
-        return {
-            year: p(year),
-            month: p(month),
-            day: p(day),
-            hours: p(hours),
-            minutes: p(minutes),
-            seconds: p(seconds),
-        };
+        return Date.parse(dateStr);
     }
 
     function getNowDate() {
-        // デフォルトのDateオブジェクトはタイムゾーン関係が面倒なので独自のものを使用する
-        const now = new Date();
-        // 一旦UTCにする
-        now.setMinutes(now.getMinutes() + now.getTimezoneOffset());
-        // JSTにする
-        const jstOffset = 60 * 9;
-        now.setMinutes(now.getMinutes() + jstOffset);
-        return {
-            year: now.getFullYear(),
-            month: now.getMonth() + 1,
-            day: now.getDate(),
-            hours: now.getHours(),
-            minutes: now.getMinutes(),
-            seconds: now.getSeconds(),
-        }
-    }
-
-    function toRawDate(date) {
-        return new Date(date.year, date.month - 1, date.day, date.hours, date.minutes, date.seconds);
+        return Date.now() + clockOffset;
     }
 
     // 日付の引き算
     // 単位は秒
     function subDate(date1, date2) {
-        // 引き算ではタイムゾーンの影響がないので一旦デフォルトのDateに戻して計算する
-        return (toRawDate(date1) - toRawDate(date2)) / 1000;
+        return (date1 - date2) / 1000;
     }
 })();
\ No newline at end of file
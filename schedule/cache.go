@@ -0,0 +1,47 @@
+// 作成済みのスケジュールのキャッシュ
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/cache"
+)
+
+// 作成済みのスケジュールは基本的に変更されないので長めにする
+const cacheTTL = time.Hour
+
+var scheduleCache = cache.New()
+
+// GetCached キャッシュを経由してスケジュールを取得する
+// 存在しない場合はエクスポートで作成される可能性があるのでキャッシュしない
+func GetCached(ctx context.Context, storeClient *firestore.Client, t time.Time, opts Options) (Schedule, error) {
+	key := broadcast.Key(t)
+	v, ok := scheduleCache.Get(key)
+	if ok {
+		return v.(Schedule), nil
+	}
+
+	s, err := Get(ctx, storeClient, t, opts)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	scheduleCache.Set(key, s, cacheTTL)
+	return s, nil
+}
+
+// OnInvalidate スケジュールが変更された場合に呼び出される
+// レスポンスのキャッシュを持っている場合に設定する
+var OnInvalidate func()
+
+// Invalidate スケジュールが変更された場合に呼び出す
+func Invalidate(key string) {
+	scheduleCache.Delete(key)
+	if OnInvalidate != nil {
+		OnInvalidate()
+	}
+}
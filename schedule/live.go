@@ -0,0 +1,144 @@
+// ライブ配信の同時放送
+// ソースのチャンネルが配信している間、設定したチャンネルの番組を配信に差し替える
+// 配信が終わるとスケジュールの時刻どおりの番組に戻る
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/cache"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// Live 配信中のライブ、Info/Liveに保存する
+type Live struct {
+	VideoID   string    `firestore:"videoId" json:"videoId"`
+	Title     string    `firestore:"title" json:"title"`
+	StartedAt time.Time `firestore:"startedAt" json:"startedAt"`
+	// CheckedAt 最後に配信中であることを確認した時刻
+	CheckedAt time.Time `firestore:"checkedAt" json:"checkedAt"`
+}
+
+// LiveStaleAfter これ以上確認されていない配信は、確認するジョブが止まっているとみなして終わったものとして扱う
+const LiveStaleAfter = 10 * time.Minute
+
+// 配信の開始と終了はこの時間が経つまで反映されない
+const LiveCacheTTL = 30 * time.Second
+
+const liveCacheKey = "live"
+
+var liveCache = cache.New()
+
+// GetLive 時刻tに配信中のライブを返す
+// 配信していない、もしくは同時放送しない設定の場合はfalseを返す
+func GetLive(ctx context.Context, storeClient *firestore.Client, t time.Time, opts Options) (Live, bool, error) {
+	if opts.LiveChannel < 0 || opts.LiveChannel >= opts.ChannelCount {
+		return Live{}, false, nil
+	}
+
+	var l Live
+	if v, ok := liveCache.Get(liveCacheKey); ok {
+		l = v.(Live)
+	} else {
+		metrics.CountFirestoreReads("live", 1)
+		snap, err := storeClient.Collection("Info").Doc("Live").Get(ctx)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return Live{}, false, err
+		}
+		if snap.Exists() {
+			err = snap.DataTo(&l)
+			if err != nil {
+				return Live{}, false, err
+			}
+		}
+		liveCache.Set(liveCacheKey, l, LiveCacheTTL)
+	}
+
+	if l.VideoID == "" || t.Before(l.StartedAt) || t.Sub(l.CheckedAt) > LiveStaleAfter {
+		return Live{}, false, nil
+	}
+
+	return l, true, nil
+}
+
+// SaveLive 配信中のライブを保存する
+// 配信が終わった場合はゼロ値を保存する
+func SaveLive(ctx context.Context, storeClient *firestore.Client, l Live) error {
+	_, err := storeClient.Collection("Info").Doc("Live").Set(ctx, l)
+	liveCache.Delete(liveCacheKey)
+	return err
+}
+
+// LiveItem 時刻tまでの配信を番組として返す
+func (l Live) LiveItem(t time.Time) Item {
+	return Item{
+		Time:     l.StartedAt,
+		Duration: t.Sub(l.StartedAt),
+		VideoID:  l.VideoID,
+		Live:     true,
+	}
+}
+
+// WithLive channelの配信開始からuntilまでの番組を配信に差し替える
+// 配信開始時に再生中だった番組は配信開始で終わるようにする
+func (s Schedule) WithLive(l Live, channel int, until time.Time) Schedule {
+	if channel < 0 || channel >= len(s.Channels) || !until.After(l.StartedAt) {
+		return s
+	}
+
+	// キャッシュしているスケジュールを変更しないようにコピーする
+	channels := make([]Channel, len(s.Channels))
+	copy(channels, s.Channels)
+
+	items := make([]Item, 0, len(channels[channel].Items)+1)
+	inserted := false
+	for _, it := range channels[channel].Items {
+		if !it.Time.Before(until) && !inserted {
+			items = append(items, l.LiveItem(until))
+			inserted = true
+		}
+
+		switch {
+		case !it.Time.Add(it.Duration).After(l.StartedAt):
+		case it.Time.Before(l.StartedAt):
+			it.Duration = l.StartedAt.Sub(it.Time)
+		case !it.Time.Before(until):
+		default:
+			continue
+		}
+		items = append(items, it)
+	}
+	if !inserted {
+		items = append(items, l.LiveItem(until))
+	}
+	channels[channel] = Channel{Items: items}
+
+	s.Channels = channels
+	return s
+}
+
+// WithLive channelの再生中の番組を配信に差し替える
+// 配信が終わる時刻は分からないので次の番組は返さない
+func (n Now) WithLive(l Live, channel int) Now {
+	if channel < 0 || channel >= len(n.Channels) {
+		return n
+	}
+
+	channels := make([]NowChannel, len(n.Channels))
+	copy(channels, n.Channels)
+
+	current := l.LiveItem(n.ServerTime)
+	current.Time = current.Time.UTC()
+	channels[channel] = NowChannel{
+		Current: &current,
+		Offset:  n.ServerTime.Sub(l.StartedAt),
+	}
+
+	n.Channels = channels
+	return n
+}
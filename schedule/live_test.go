@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduleWithLive(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time {
+		return base.Add(time.Duration(minute) * time.Minute)
+	}
+	item := func(id string, start, duration int) Item {
+		return Item{Time: at(start), Duration: time.Duration(duration) * time.Minute, VideoID: id}
+	}
+	live := func(start, duration int) Item {
+		it := item("live", start, duration)
+		it.Live = true
+		return it
+	}
+	newSchedule := func() Schedule {
+		return Schedule{Channels: []Channel{
+			{Items: []Item{item("a", 0, 10), item("b", 10, 10), item("c", 20, 10), item("d", 30, 10)}},
+			{Items: []Item{item("x", 0, 40)}},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		started time.Time
+		channel int
+		until   time.Time
+		want    []Item
+	}{
+		{
+			name:    "replace items while live",
+			started: at(15),
+			until:   at(25),
+			want:    []Item{item("a", 0, 10), item("b", 10, 5), live(15, 10), item("d", 30, 10)},
+		},
+		{
+			name:    "start at the boundary",
+			started: at(10),
+			until:   at(30),
+			want:    []Item{item("a", 0, 10), live(10, 20), item("d", 30, 10)},
+		},
+		{
+			name:    "until after the last item",
+			started: at(35),
+			until:   at(60),
+			want:    []Item{item("a", 0, 10), item("b", 10, 10), item("c", 20, 10), item("d", 30, 5), live(35, 25)},
+		},
+		{
+			name:    "channel out of range",
+			started: at(15),
+			channel: 2,
+			until:   at(25),
+			want:    newSchedule().Channels[0].Items,
+		},
+		{
+			name:    "until before the start",
+			started: at(15),
+			until:   at(15),
+			want:    newSchedule().Channels[0].Items,
+		},
+	}
+
+	for _, tt := range tests {
+		s := newSchedule()
+		l := Live{VideoID: "live", StartedAt: tt.started}
+		got := s.WithLive(l, tt.channel, tt.until)
+
+		if !reflect.DeepEqual(got.Channels[0].Items, tt.want) {
+			t.Errorf("%v: items = %v, want %v", tt.name, got.Channels[0].Items, tt.want)
+		}
+		// 他のチャンネルと元のスケジュールは変更しない
+		if !reflect.DeepEqual(got.Channels[1], newSchedule().Channels[1]) {
+			t.Errorf("%v: other channel is changed: %v", tt.name, got.Channels[1])
+		}
+		if !reflect.DeepEqual(s, newSchedule()) {
+			t.Errorf("%v: original schedule is changed: %v", tt.name, s)
+		}
+	}
+}
+
+func TestNowWithLive(t *testing.T) {
+	now := time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)
+	current := Item{Time: now.Add(-5 * time.Minute), Duration: 10 * time.Minute, VideoID: "a"}
+	next := Item{Time: now.Add(5 * time.Minute), Duration: 10 * time.Minute, VideoID: "b"}
+	n := Now{
+		ServerTime: now,
+		Channels: []NowChannel{
+			{Current: &current, Offset: 5 * time.Minute, Next: &next},
+			{Current: &current, Offset: 5 * time.Minute, Next: &next},
+		},
+	}
+	l := Live{VideoID: "live", StartedAt: now.Add(-30 * time.Minute)}
+
+	got := n.WithLive(l, 1)
+	ch := got.Channels[1]
+	if ch.Current == nil || ch.Current.VideoID != "live" || !ch.Current.Live || ch.Current.Duration != 30*time.Minute {
+		t.Errorf("current = %+v, want the live", ch.Current)
+	}
+	if ch.Offset != 30*time.Minute {
+		t.Errorf("offset = %v, want %v", ch.Offset, 30*time.Minute)
+	}
+	if ch.Next != nil {
+		t.Errorf("next = %+v, want nil", ch.Next)
+	}
+	if got.Channels[0].Current.VideoID != "a" || n.Channels[1].Current.VideoID != "a" {
+		t.Errorf("other channel or original is changed")
+	}
+
+	if unchanged := n.WithLive(l, 2); !reflect.DeepEqual(unchanged, n) {
+		t.Errorf("channel out of range should not change now")
+	}
+}
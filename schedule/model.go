@@ -0,0 +1,17 @@
+package schedule
+
+// MaxChannelCount スケジュールのドキュメントに保存できるチャンネルの数
+const MaxChannelCount = 4
+
+type forStore struct {
+	Channel1 []byte `firestore:"channel1"`
+	Channel2 []byte `firestore:"channel2"`
+	Channel3 []byte `firestore:"channel3"`
+	Channel4 []byte `firestore:"channel4"`
+	// SeriesCursorBefore 作成する前のシリーズのカーソル、削除したときに戻す
+	SeriesCursorBefore *SeriesCursor `firestore:"seriesCursorBefore,omitempty"`
+}
+
+func (s *forStore) channelSlots() []*[]byte {
+	return []*[]byte{&s.Channel1, &s.Channel2, &s.Channel3, &s.Channel4}
+}
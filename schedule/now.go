@@ -0,0 +1,69 @@
+// 現在再生中の番組をサーバーの時計で計算する
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+type NowChannel struct {
+	// Current 再生中の番組、番組がない時間帯はnil
+	Current *Item
+	// Offset 再生中の番組の開始からの経過時間
+	Offset time.Duration
+	// Next 次の番組、存在しない場合はnil
+	Next *Item
+}
+
+// Now 各チャンネルで今放送している番組
+type Now struct {
+	ServerTime time.Time
+	Zone       string
+	Channels   []NowChannel
+}
+
+// LoadAround tを含む放送日のスケジュールに前後の日のスケジュールをつなげたものを取得する
+// 次の番組が翌日のスケジュールにある場合があるので翌日の分まで読み込む
+func LoadAround(ctx context.Context, storeClient *firestore.Client, t time.Time, opts Options) (Schedule, error) {
+	return LoadRange(ctx, storeClient, t, broadcast.NextDay(t), opts)
+}
+
+// GetNow 時刻tに各チャンネルで再生されている番組を取得する
+func GetNow(s Schedule, t time.Time) Now {
+	result := Now{
+		ServerTime: t.UTC(),
+		Zone:       broadcast.Location.String(),
+		Channels:   make([]NowChannel, len(s.Channels)),
+	}
+
+	for i, c := range s.UTC().Channels {
+		ch := NowChannel{}
+		index, err := c.ItemIndex(t)
+		if err == nil {
+			current := c.Items[index]
+			ch.Current = &current
+			ch.Offset = t.Sub(current.Time)
+			if index+1 < len(c.Items) {
+				next := c.Items[index+1]
+				ch.Next = &next
+			}
+		} else {
+			// 番組がない時間帯は次に始まる番組だけ返す
+			for _, it := range c.Items {
+				if it.Time.After(t) {
+					next := it
+					ch.Next = &next
+					break
+				}
+			}
+		}
+
+		result.Channels[i] = ch
+	}
+
+	return result
+}
@@ -0,0 +1,98 @@
+// スケジュールの作成と読み込みの設定
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Options 設定ファイルから作成して、スケジュールを作成、読み込みする関数に渡す
+type Options struct {
+	// ChannelCount 編成するチャンネルの数
+	ChannelCount int
+	// MaxVideoDuration これ以上の長さの動画は通常は編成しない
+	MaxVideoDuration time.Duration
+	// PlaylistIDs ソースとして取り込んだプレイリスト、プレイリストにしかない動画も候補に入れる
+	PlaylistIDs []string
+	// ChannelPlaylists チャンネルごとに順番に放送するプレイリスト、空の場合はランダムに編成する
+	ChannelPlaylists []string
+	// LiveChannel 配信に差し替えるチャンネル(0から)、負の場合は同時放送しない
+	LiveChannel int
+	Series      SeriesOptions
+}
+
+// DefaultOptions 設定ファイルがない場合と同じ設定
+func DefaultOptions() Options {
+	return Options{
+		ChannelCount:     MaxChannelCount,
+		MaxVideoDuration: 30 * time.Minute,
+		LiveChannel:      -1,
+		Series: SeriesOptions{
+			Mode:      SeriesModeOff,
+			BlockSize: 3,
+			Slot:      20 * time.Hour,
+		},
+	}
+}
+
+// channelPlaylist i番目のチャンネルで放送するプレイリスト
+func (o Options) channelPlaylist(i int) string {
+	if i < len(o.ChannelPlaylists) {
+		return o.ChannelPlaylists[i]
+	}
+	return ""
+}
+
+type ErrInvalidOptions struct {
+	Issues []string
+}
+
+func (e ErrInvalidOptions) Error() string {
+	return "invalid schedule options: " + strings.Join(e.Issues, ", ")
+}
+
+// Validate 不正な値をまとめてErrInvalidOptionsで返す
+func (o Options) Validate() error {
+	var issues []string
+	add := func(format string, args ...interface{}) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+
+	if o.ChannelCount < 1 || o.ChannelCount > MaxChannelCount {
+		add("channel count must be between 1 and %v", MaxChannelCount)
+	}
+	if o.MaxVideoDuration <= 0 {
+		add("max video duration must be positive")
+	}
+	if len(o.ChannelPlaylists) > o.ChannelCount {
+		add("channel playlists must be at most the number of channels")
+	}
+	if o.LiveChannel >= o.ChannelCount {
+		add("live channel must be less than the number of channels")
+	}
+
+	switch o.Series.Mode {
+	case SeriesModeOff, SeriesModeBlock, SeriesModeDaily:
+	default:
+		add("series mode must be off, block or daily")
+	}
+	if o.Series.BlockSize < 1 {
+		add("series block size must be positive")
+	}
+	if o.Series.Slot < 0 || o.Series.Slot >= 24*time.Hour {
+		add("series slot must be between 00:00 and 23:59")
+	}
+	if o.Series.Mode == SeriesModeDaily {
+		if o.Series.Channel < 0 || o.Series.Channel >= o.ChannelCount {
+			add("series channel must be one of the channels")
+		} else if o.channelPlaylist(o.Series.Channel) != "" {
+			add("series channel must not have a playlist")
+		}
+	}
+
+	if len(issues) > 0 {
+		return ErrInvalidOptions{Issues: issues}
+	}
+	return nil
+}
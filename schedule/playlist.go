@@ -0,0 +1,67 @@
+// プレイリストを順番に放送するチャンネル(シリーズモード)
+package schedule
+
+import (
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+)
+
+type ErrEmptyPlaylist string
+
+func (s ErrEmptyPlaylist) Error() string {
+	return "playlist has no videos: " + string(s)
+}
+
+// playlistCursor 前日のチャンネルの最後に放送したプレイリストの動画の次の位置
+// 前日にプレイリストの動画を放送していない場合は最初から
+func playlistCursor(p library.Playlist, prevChannel *Channel) int {
+	if prevChannel == nil {
+		return 0
+	}
+
+	for i := len(prevChannel.Items) - 1; i >= 0; i-- {
+		pos := p.Position(prevChannel.Items[i].VideoID)
+		if pos >= 0 {
+			return (pos + 1) % len(p.Items)
+		}
+	}
+
+	return 0
+}
+
+// createPlaylistChannel 前日の続きからプレイリストの順番に並べる
+// 最後まで放送したら最初に戻る
+func createPlaylistChannel(p library.Playlist, prevChannel *Channel, startTime time.Time) (Channel, error) {
+	// 長さが取得できていない動画は時間が進まないので使わない
+	playable := make([]library.PlaylistItem, 0, len(p.Items))
+	for _, it := range p.Items {
+		if it.Duration > 0 {
+			playable = append(playable, it)
+		}
+	}
+	p.Items = playable
+	if len(p.Items) == 0 {
+		return Channel{}, ErrEmptyPlaylist(p.ID)
+	}
+
+	cursor := playlistCursor(p, prevChannel)
+	currentTime := startTime
+	nextDay := broadcast.NextDay(startTime)
+	items := []Item{}
+	for currentTime.Before(nextDay) {
+		it := p.Items[cursor]
+		items = append(items, Item{
+			Time:     currentTime,
+			Duration: it.Duration,
+			VideoID:  it.VideoID,
+		})
+		currentTime = currentTime.Add(it.Duration)
+		cursor = (cursor + 1) % len(p.Items)
+	}
+
+	return Channel{
+		Items: items,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+)
+
+func testPlaylist(hours ...int) library.Playlist {
+	p := library.Playlist{ID: "PLtest"}
+	for i, h := range hours {
+		p.Items = append(p.Items, library.PlaylistItem{
+			VideoID:  string(rune('a' + i)),
+			Duration: time.Duration(h) * time.Hour,
+		})
+	}
+	return p
+}
+
+// testPrevChannel 前日にidsの順番で放送したチャンネル
+func testPrevChannel(ids ...string) *Channel {
+	c := &Channel{}
+	t := broadcast.PrevDay(broadcast.DayAt(2020, 1, 1))
+	for _, id := range ids {
+		c.Items = append(c.Items, Item{Time: t, Duration: time.Hour, VideoID: id})
+		t = t.Add(time.Hour)
+	}
+	return c
+}
+
+func TestPlaylistCursor(t *testing.T) {
+	p := testPlaylist(1, 1, 1, 1)
+
+	tests := []struct {
+		name string
+		prev *Channel
+		want int
+	}{
+		{"no previous channel", nil, 0},
+		{"continue from the last item", testPrevChannel("a", "b"), 2},
+		{"wrap around", testPrevChannel("c", "d"), 0},
+		// プレイリストにない番組(配信や再利用したチャンネル)は飛ばして探す
+		{"skip other videos", testPrevChannel("a", "b", "x", "y"), 2},
+		{"no playlist videos", testPrevChannel("x", "y"), 0},
+		{"empty previous channel", &Channel{}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := playlistCursor(p, tt.prev); got != tt.want {
+			t.Errorf("%v: playlistCursor = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCreatePlaylistChannel(t *testing.T) {
+	day := broadcast.DayAt(2020, 1, 1)
+	ids := func(c Channel) []string {
+		var ids []string
+		for _, it := range c.Items {
+			ids = append(ids, it.VideoID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		playlist library.Playlist
+		prev     *Channel
+		start    time.Time
+		want     []string
+		err      error
+	}{
+		{
+			name:     "from the first item",
+			playlist: testPlaylist(8, 8, 8),
+			start:    day,
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			// 1日で最後まで放送したら最初に戻る
+			name:     "wrap around",
+			playlist: testPlaylist(5, 5),
+			start:    day,
+			want:     []string{"a", "b", "a", "b", "a"},
+		},
+		{
+			name:     "resume from the previous day",
+			playlist: testPlaylist(8, 8, 8),
+			prev:     testPrevChannel("x", "b"),
+			start:    day,
+			want:     []string{"c", "a", "b"},
+		},
+		{
+			// 前日の最後の番組が延びた場合はその時刻から
+			name:     "resume after the previous day",
+			playlist: testPlaylist(10, 10, 10),
+			prev:     testPrevChannel("a"),
+			start:    day.Add(6 * time.Hour),
+			want:     []string{"b", "c"},
+		},
+		{
+			// 長さが取得できていない動画は飛ばして、その次から続ける
+			name:     "skip videos without duration",
+			playlist: testPlaylist(8, 0, 8, 8),
+			prev:     testPrevChannel("a"),
+			start:    day,
+			want:     []string{"c", "d", "a"},
+		},
+		{
+			name:     "empty playlist",
+			playlist: testPlaylist(),
+			start:    day,
+			err:      ErrEmptyPlaylist("PLtest"),
+		},
+		{
+			name:     "no playable videos",
+			playlist: testPlaylist(0, 0),
+			start:    day,
+			err:      ErrEmptyPlaylist("PLtest"),
+		},
+	}
+
+	for _, tt := range tests {
+		c, err := createPlaylistChannel(tt.playlist, tt.prev, tt.start)
+		if tt.err != nil {
+			if err != tt.err {
+				t.Errorf("%v: createPlaylistChannel returned %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: createPlaylistChannel returned error: %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(ids(c), tt.want) {
+			t.Errorf("%v: items = %v, want %v", tt.name, ids(c), tt.want)
+		}
+		checkFilled(t, tt.name, c, tt.start)
+	}
+}
@@ -0,0 +1,78 @@
+// 複数の放送日にまたがるスケジュールの読み込み
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+)
+
+type ErrNotExists struct{}
+
+func (ErrNotExists) Error() string {
+	return "schedule doesn't exist"
+}
+
+// LoadRange startからendまでにかかる放送日のスケジュールをつなげて取得する
+// 前日の最後の番組は日付をまたいで再生されるためstartの前日の分から読み込む
+// 1日も存在しない場合はErrNotExistsを返す
+func LoadRange(ctx context.Context, storeClient *firestore.Client, start, end time.Time, opts Options) (Schedule, error) {
+	var result *Schedule
+	last := broadcast.DayStart(end)
+	for day := broadcast.PrevDay(start); !day.After(last); day = broadcast.NextDay(day) {
+		s, err := GetCached(ctx, storeClient, day, opts)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			return Schedule{}, err
+		}
+
+		if result == nil {
+			result = &s
+		} else {
+			merged := result.Merge(s)
+			result = &merged
+		}
+	}
+
+	if result == nil {
+		return Schedule{}, ErrNotExists{}
+	}
+
+	return *result, nil
+}
+
+// NextChange startからduration分のPartの結果が次に変わる時刻を返す
+// 番組の終了時刻か、次の番組が範囲に入ってくる時刻のうち早いほう
+// 変わらない場合はゼロ値を返す
+func (s Schedule) NextChange(start time.Time, duration time.Duration) time.Time {
+	end := start.Add(duration)
+	var result time.Time
+	update := func(t time.Time) {
+		if result.IsZero() || t.Before(result) {
+			result = t
+		}
+	}
+
+	for _, c := range s.Channels {
+		for _, it := range c.Items {
+			finish := it.Time.Add(it.Duration)
+			if !finish.Before(start) {
+				update(finish)
+			}
+
+			if it.Time.After(end) {
+				update(it.Time.Add(-duration))
+				break
+			}
+		}
+	}
+
+	return result
+}
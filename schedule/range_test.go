@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNextChange(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time {
+		return base.Add(time.Duration(minute) * time.Minute)
+	}
+	channel := func(offset int, durations ...int) Channel {
+		var c Channel
+		minute := offset
+		for _, d := range durations {
+			c.Items = append(c.Items, Item{
+				Time:     at(minute),
+				Duration: time.Duration(d) * time.Minute,
+				VideoID:  "v",
+			})
+			minute += d
+		}
+		return c
+	}
+
+	single := Schedule{Channels: []Channel{channel(0, 10, 10, 10, 10)}}
+	tests := []struct {
+		name     string
+		s        Schedule
+		start    time.Time
+		duration time.Duration
+		want     time.Time
+	}{
+		// 次の番組が範囲に入る時刻
+		{"next item comes into the range", single, at(0), 5 * time.Minute, at(5)},
+		{"next item already in the range", single, at(5), 10 * time.Minute, at(10)},
+		{"finish at the start", single, at(10), 5 * time.Minute, at(10)},
+		// 最後の番組は終了時刻
+		{"last item", single, at(35), time.Hour, at(40)},
+		{"after the schedule", single, at(50), time.Hour, time.Time{}},
+		{
+			name:     "earliest of the channels",
+			s:        Schedule{Channels: []Channel{channel(0, 30, 30), channel(0, 12, 18)}},
+			start:    at(5),
+			duration: 5 * time.Minute,
+			want:     at(7),
+		},
+		{
+			name:     "finish before another item comes into the range",
+			s:        Schedule{Channels: []Channel{channel(0, 10), channel(30, 10)}},
+			start:    at(0),
+			duration: 5 * time.Minute,
+			want:     at(10),
+		},
+		{"empty", Schedule{}, at(0), time.Hour, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		got := tt.s.NextChange(tt.start, tt.duration)
+		if !got.Equal(tt.want) {
+			t.Errorf("%v: NextChange = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
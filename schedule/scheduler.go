@@ -0,0 +1,922 @@
+// 1日分のスケジュールを作成する
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/jobrun"
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// VideoSource スケジュールに入れる動画の候補
+type VideoSource struct {
+	opts      Options
+	r         *rand.Rand
+	videos    []library.IndexEntry
+	playlists map[string]library.Playlist
+	series    *seriesPlanner
+}
+
+// LoadCandidates インデックスとソースのプレイリストからスケジュールに入れる動画の候補を読み込む
+// プレイリストにしかない他のチャンネルの動画も候補に入れる
+func LoadCandidates(ctx context.Context, c *firestore.Client, opts Options) (library.Index, map[string]library.Playlist, error) {
+	idx, err := library.CachedIndex(ctx, c)
+	if err != nil {
+		return library.Index{}, nil, err
+	}
+
+	playlists, err := library.LoadPlaylists(ctx, c, opts.PlaylistIDs)
+	if err != nil {
+		return library.Index{}, nil, err
+	}
+
+	// キャッシュされているインデックスを書き換えないようにコピーする
+	videos := append([]library.IndexEntry(nil), idx.Entries...)
+	seen := make(map[string]struct{}, len(videos))
+	for _, e := range videos {
+		seen[e.ID] = struct{}{}
+	}
+	for _, id := range opts.PlaylistIDs {
+		for _, e := range playlists[id].Entries() {
+			if _, ok := seen[e.ID]; ok {
+				continue
+			}
+			seen[e.ID] = struct{}{}
+			videos = append(videos, e)
+		}
+	}
+
+	return library.Index{Entries: videos}, playlists, nil
+}
+
+// NewVideoSource インデックスとソースのプレイリストから候補を読み込む
+func NewVideoSource(ctx context.Context, c *firestore.Client, opts Options) (*VideoSource, error) {
+	idx, playlists, err := LoadCandidates(ctx, c, opts)
+	if err != nil {
+		return nil, err
+	}
+	videos := idx.Entries
+
+	series, err := loadSeriesPlanner(ctx, c, playlists, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// dailyのシリーズは最初の放送の前から他の番組で流れないように先に選んでおく
+	series.chooseDaily(r, "")
+
+	return &VideoSource{
+		opts:      opts,
+		r:         r,
+		videos:    videos,
+		playlists: playlists,
+		series:    series,
+	}, nil
+}
+
+// Playlist 取り込まれているソースのプレイリスト
+func (vs *VideoSource) Playlist(id string) (library.Playlist, bool) {
+	p, ok := vs.playlists[id]
+	return p, ok
+}
+
+func (vs *VideoSource) Index() library.Index {
+	return library.Index{
+		Entries: vs.videos,
+	}
+}
+
+// ErrCanNotFetchVideo 除外されていない候補が残っていない
+type ErrCanNotFetchVideo struct{}
+
+func (ErrCanNotFetchVideo) Error() string {
+	return "can not fetch video"
+}
+
+// GetVideo excludeIDsに含まれない動画を一様ランダムに選ぶ
+func (vs *VideoSource) GetVideo(excludeIDs map[string]struct{}) (library.IndexEntry, error) {
+	l := len(vs.videos)
+	if l == 0 {
+		return library.IndexEntry{}, ErrCanNotFetchVideo{}
+	}
+
+	// 除外される動画が少なければ引き直しで十分
+	if len(excludeIDs) < l/2 {
+		for {
+			v := vs.videos[vs.r.Intn(l)]
+			_, ok := excludeIDs[v.ID]
+			if ok {
+				continue
+			}
+
+			return v, nil
+		}
+	}
+
+	// 除外される動画が多い場合は候補を列挙してから選ぶ
+	candidates := make([]int, 0, l)
+	for i, v := range vs.videos {
+		_, ok := excludeIDs[v.ID]
+		if ok {
+			continue
+		}
+		candidates = append(candidates, i)
+	}
+
+	if len(candidates) == 0 {
+		return library.IndexEntry{}, ErrCanNotFetchVideo{}
+	}
+
+	return vs.videos[candidates[vs.r.Intn(len(candidates))]], nil
+}
+
+// Item 番組、Timeに開始してDurationの間VideoIDの動画を再生する
+type Item struct {
+	Time     time.Time
+	Duration time.Duration
+	VideoID  string
+	// Live ライブ配信の同時放送、Durationは配信開始からの経過時間で終了時刻は決まっていない
+	Live bool `json:",omitempty"`
+}
+
+// Channel 時刻順に並んだ番組
+type Channel struct {
+	Items []Item
+}
+
+// FinishTime 最後の番組が終わる時刻
+func (c Channel) FinishTime() time.Time {
+	l := len(c.Items)
+	if l == 0 {
+		return time.Time{}
+	}
+
+	item := c.Items[l-1]
+	return item.Time.Add(item.Duration)
+}
+
+type ErrItemNotExists struct{}
+
+func (ErrItemNotExists) Error() string {
+	return "not exists"
+}
+
+// ItemIndex 時刻tに再生されている番組の位置を取得する
+func (c Channel) ItemIndex(t time.Time) (int, error) {
+	for i, item := range c.Items {
+		if t.Before(item.Time) {
+			continue
+		}
+
+		if t.Before(item.Time.Add(item.Duration)) {
+			return i, nil
+		}
+	}
+
+	return -1, ErrItemNotExists{}
+}
+
+// VideoIDAt 時刻tに再生されている動画のID
+func (c Channel) VideoIDAt(t time.Time) (string, error) {
+	i, err := c.ItemIndex(t)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Items[i].VideoID, nil
+}
+
+// Schedule 1放送日分の全チャンネルの番組
+type Schedule struct {
+	Channels []Channel
+	// UpdatedAt 保存された日時、つなげたスケジュールの場合は最も新しいもの
+	UpdatedAt time.Time
+	// seriesCursor 作成したときのシリーズのカーソル、Saveで一緒に保存する
+	seriesCursor *SeriesCursor
+	// seriesCursorBefore 作成する前のシリーズのカーソル
+	seriesCursorBefore *SeriesCursor
+}
+
+// Merge 次の放送日のスケジュールをつなげる
+func (s Schedule) Merge(other Schedule) Schedule {
+	result := Schedule{
+		Channels:  make([]Channel, 0, len(s.Channels)),
+		UpdatedAt: s.UpdatedAt,
+	}
+	if other.UpdatedAt.After(result.UpdatedAt) {
+		result.UpdatedAt = other.UpdatedAt
+	}
+
+	for i, c := range s.Channels {
+		var newChannel Channel
+		var otherChannel Channel
+		if i < len(other.Channels) {
+			otherChannel = other.Channels[i]
+		}
+
+		newChannel.Items = make([]Item, 0, len(c.Items)+len(otherChannel.Items))
+		for _, it := range c.Items {
+			newChannel.Items = append(newChannel.Items, it)
+		}
+		for _, it := range otherChannel.Items {
+			newChannel.Items = append(newChannel.Items, it)
+		}
+		result.Channels = append(result.Channels, newChannel)
+	}
+
+	return result
+}
+
+// UTC 時刻をすべてUTCにしたスケジュールを返す
+func (s Schedule) UTC() Schedule {
+	result := Schedule{
+		Channels:  make([]Channel, len(s.Channels)),
+		UpdatedAt: s.UpdatedAt,
+	}
+
+	for i, c := range s.Channels {
+		items := make([]Item, len(c.Items))
+		for j, it := range c.Items {
+			it.Time = it.Time.UTC()
+			items[j] = it
+		}
+		result.Channels[i].Items = items
+	}
+
+	return result
+}
+
+// Part startTime時間を含む場所からDuration分のスケジュールを取得する
+func (s Schedule) Part(startTime time.Time, duration time.Duration) Schedule {
+	result := Schedule{
+		Channels:  make([]Channel, len(s.Channels)),
+		UpdatedAt: s.UpdatedAt,
+	}
+
+	endTime := startTime.Add(duration)
+
+	for i, c := range s.Channels {
+		newChannel := Channel{}
+		for _, it := range c.Items {
+			finish := it.Time.Add(it.Duration)
+			if finish.Before(startTime) {
+				continue
+			}
+
+			if it.Time.After(endTime) {
+				break
+			}
+
+			newChannel.Items = append(newChannel.Items, it)
+		}
+
+		result.Channels[i] = newChannel
+	}
+
+	return result
+}
+
+// Get 保存されているスケジュールを取得する
+// 存在しない場合はcodes.NotFoundのエラーを返す
+func Get(ctx context.Context, storeClient *firestore.Client, t time.Time, opts Options) (Schedule, error) {
+	key := broadcast.Key(t)
+	metrics.CountFirestoreReads("schedule", 1)
+	snap, err := storeClient.Collection("Schedule").Doc(key).Get(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	var s forStore
+	snap.DataTo(&s)
+	// チャンネルの数を減らした場合は残りを使わず、増やした場合は空のチャンネルにする
+	channels := make([]Channel, opts.ChannelCount)
+	for i, data := range s.channelSlots() {
+		if i >= opts.ChannelCount || len(*data) == 0 {
+			continue
+		}
+
+		err = json.Unmarshal(*data, &channels[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+	}
+
+	return Schedule{
+		Channels:  channels,
+		UpdatedAt: snap.UpdateTime,
+	}, nil
+}
+
+// channelConstraints チャンネルを作成する際の制約
+// 通常はすべて有効で、作成に失敗した場合は順番に緩める
+type channelConstraints struct {
+	// noRepeat 1つのチャンネルでは1日はかぶりなし
+	noRepeat bool
+	// noSimultaneous 他のチャンネルと同じ時間にはかぶりなし
+	noSimultaneous bool
+	// noLong MaxVideoDuration以上の動画は候補に入れない
+	noLong bool
+}
+
+var strictConstraints = channelConstraints{
+	noRepeat:       true,
+	noSimultaneous: true,
+	noLong:         true,
+}
+
+// relaxedConstraints 作成に失敗したときに順番に試す制約
+var relaxedConstraints = []channelConstraints{
+	{noRepeat: true, noSimultaneous: false, noLong: true},
+	{noRepeat: false, noSimultaneous: false, noLong: true},
+	{noRepeat: false, noSimultaneous: false, noLong: false},
+}
+
+// ErrChannelGeneration 制約を緩めてもチャンネルを作成できなかった、Channelは0から
+type ErrChannelGeneration struct {
+	Channel int
+	Err     error
+}
+
+func (e ErrChannelGeneration) Error() string {
+	return fmt.Sprintf("can not create channel %v: %v", e.Channel+1, e.Err)
+}
+
+// ErrEmpty 番組がないチャンネルを含むスケジュールは保存しない
+type ErrEmpty struct{}
+
+func (ErrEmpty) Error() string {
+	return "schedule has an empty channel"
+}
+
+type ErrInvalid struct {
+	Report Report
+}
+
+func (e ErrInvalid) Error() string {
+	count := 0
+	for _, i := range e.Report.Issues {
+		if i.Severity == SeverityError {
+			count++
+		}
+	}
+	return fmt.Sprintf("invalid schedule %v: %v errors", broadcast.Key(e.Report.Date), count)
+}
+
+// rejectEpisode シリーズの話を時刻tに放送できない場合は理由を返す
+// 長さが取得できていない、もしくは長すぎる話は待っても放送できないので、permanentをtrueにして飛ばせるようにする
+func (c channelConstraints) rejectEpisode(source *VideoSource, e library.Episode, t time.Time, otherChannels []Channel, excludeIDs map[string]struct{}) (reason string, permanent bool) {
+	if e.Duration <= 0 {
+		return "no_duration", true
+	}
+	if c.noLong && e.Duration >= source.opts.MaxVideoDuration {
+		return "too_long", true
+	}
+	if _, ok := excludeIDs[e.VideoID]; ok {
+		return "series_excluded", false
+	}
+	if c.noSimultaneous {
+		for _, ch := range otherChannels {
+			id, err := ch.VideoIDAt(t)
+			if err == nil && id == e.VideoID {
+				return "series_excluded", false
+			}
+		}
+	}
+	return "", false
+}
+
+// createChannel slotTimeが0でない場合は、その時刻を過ぎた最初の番組をdailyのシリーズの続きにする
+func createChannel(source *VideoSource, startTime time.Time, otherChannels []Channel, constraints channelConstraints, slotTime time.Time) (Channel, error) {
+	currentTime := startTime
+	items := []Item{}
+
+	nextDay := broadcast.NextDay(startTime)
+
+	// airSeries シリーズの続きをcurrentTimeから最大max話放送して、放送した話数を返す
+	// 放送できない話は長さが原因なら飛ばし、それ以外なら放送をやめる、最後の話で終わり最初には戻らない
+	airSeries := func(s library.Series, max int, excludeIDs map[string]struct{}) int {
+		n := 0
+		for _, e := range source.series.upcoming(s) {
+			if n >= max || !currentTime.Before(nextDay) {
+				break
+			}
+
+			reason, permanent := constraints.rejectEpisode(source, e, currentTime, otherChannels, excludeIDs)
+			if reason != "" {
+				metrics.SchedulerRejections.WithLabelValues(reason).Inc()
+				if !permanent {
+					break
+				}
+				source.series.advance(source.r, s, e)
+				continue
+			}
+
+			items = append(items, Item{
+				Time:     currentTime,
+				Duration: e.Duration,
+				VideoID:  e.VideoID,
+			})
+			excludeIDs[e.VideoID] = struct{}{}
+			currentTime = currentTime.Add(e.Duration)
+			source.series.advance(source.r, s, e)
+			n++
+		}
+		return n
+	}
+
+	for currentTime.Before(nextDay) {
+		excludeIDs := make(map[string]struct{}, len(items)+len(otherChannels))
+		if constraints.noRepeat {
+			for _, item := range items {
+				excludeIDs[item.VideoID] = struct{}{}
+			}
+		} else if l := len(items); l > 0 {
+			// 制約を緩めても同じ動画が連続するのは避ける
+			excludeIDs[items[l-1].VideoID] = struct{}{}
+		}
+
+		if constraints.noSimultaneous {
+			for _, ch := range otherChannels {
+				id, err := ch.VideoIDAt(currentTime)
+				if err != nil {
+					continue
+				}
+				excludeIDs[id] = struct{}{}
+			}
+		}
+		if !slotTime.IsZero() && !currentTime.Before(slotTime) {
+			slotTime = time.Time{}
+			// 放送できない場合は今日は放送せずに次の日に続きを放送する
+			if s, ok := source.series.dailySeries(source.r); ok && airSeries(s, 1, excludeIDs) > 0 {
+				continue
+			}
+		}
+		source.series.excludeDaily(excludeIDs)
+
+		for {
+			v, err := source.GetVideo(excludeIDs)
+			if err != nil {
+				return Channel{}, err
+			}
+
+			// 長さが取得できていない動画は時間が進まないので使わない
+			if v.Duration <= 0 {
+				metrics.SchedulerRejections.WithLabelValues("no_duration").Inc()
+				excludeIDs[v.ID] = struct{}{}
+				continue
+			}
+			if constraints.noLong && v.Duration >= source.opts.MaxVideoDuration {
+				metrics.SchedulerRejections.WithLabelValues("too_long").Inc()
+				excludeIDs[v.ID] = struct{}{}
+				continue
+			}
+
+			// シリーズの1話を選んだ場合は代わりに続きから何話かまとめて放送する
+			if s, ok := source.series.blockSeries(v.ID); ok {
+				if airSeries(s, source.opts.Series.BlockSize, excludeIDs) == 0 {
+					excludeIDs[v.ID] = struct{}{}
+					continue
+				}
+				break
+			}
+
+			items = append(items, Item{
+				Time:     currentTime,
+				Duration: v.Duration,
+				VideoID:  v.ID,
+			})
+
+			currentTime = currentTime.Add(v.Duration)
+			break
+		}
+	}
+
+	return Channel{
+		Items: items,
+	}, nil
+}
+
+type ErrNoPrevChannel struct{}
+
+func (ErrNoPrevChannel) Error() string {
+	return "previous channel doesn't exist"
+}
+
+// reuseChannel 前日のチャンネルの番組をstartTimeから順番に並べ直す
+func reuseChannel(prevChannel Channel, startTime time.Time) (Channel, error) {
+	prevItems := make([]Item, 0, len(prevChannel.Items))
+	for _, it := range prevChannel.Items {
+		if it.Duration > 0 {
+			prevItems = append(prevItems, it)
+		}
+	}
+	if len(prevItems) == 0 {
+		return Channel{}, ErrNoPrevChannel{}
+	}
+
+	currentTime := startTime
+	nextDay := broadcast.NextDay(startTime)
+	items := []Item{}
+	for i := 0; currentTime.Before(nextDay); i++ {
+		it := prevItems[i%len(prevItems)]
+		items = append(items, Item{
+			Time:     currentTime,
+			Duration: it.Duration,
+			VideoID:  it.VideoID,
+		})
+		currentTime = currentTime.Add(it.Duration)
+	}
+
+	return Channel{
+		Items: items,
+	}, nil
+}
+
+// createChannelWithFallback チャンネルを作成する
+// 作成できない場合は制約を緩めて再度作成し、それでもだめな場合は前日のチャンネルを再利用する
+// 作成に失敗した途中で進めたシリーズのカーソルは戻す
+func createChannelWithFallback(ctx context.Context, source *VideoSource, prevChannel *Channel, startTime time.Time, otherChannels []Channel, slotTime time.Time) (Channel, error) {
+	cursor := source.series.save()
+	channel, err := createChannel(source, startTime, otherChannels, strictConstraints, slotTime)
+	if err == nil {
+		return channel, nil
+	}
+
+	for _, constraints := range relaxedConstraints {
+		metrics.SchedulerRejections.WithLabelValues("relaxed_constraints").Inc()
+		logging.Warning(ctx, "create channel with relaxed constraints", logging.Fields{
+			"startTime":      startTime,
+			"noRepeat":       constraints.noRepeat,
+			"noSimultaneous": constraints.noSimultaneous,
+			"noLong":         constraints.noLong,
+			"error":          err,
+		})
+		source.series.restore(cursor)
+		channel, err = createChannel(source, startTime, otherChannels, constraints, slotTime)
+		if err == nil {
+			return channel, nil
+		}
+	}
+	source.series.restore(cursor)
+
+	if prevChannel == nil {
+		return Channel{}, err
+	}
+
+	metrics.SchedulerRejections.WithLabelValues("reuse_previous").Inc()
+	logging.Warning(ctx, "reuse previous channel", logging.Fields{
+		"startTime": startTime,
+		"error":     err,
+	})
+	return reuseChannel(*prevChannel, startTime)
+}
+
+// Create 放送日tのスケジュールを作成する
+// prevScheduleがある場合は前日の最後の番組から続くようにする
+func Create(ctx context.Context, source *VideoSource, prevSchedule *Schedule, t time.Time) (Schedule, error) {
+	start := time.Now()
+	defer func() {
+		metrics.ScheduleGeneration.Observe(time.Since(start).Seconds())
+	}()
+
+	// 同じVideoSourceで続けて作成した場合もこの日を作成する直前のカーソルを保存する
+	before := source.series.snapshot()
+
+	getStartTime := func(i int) time.Time {
+		if prevSchedule == nil {
+			return t
+		}
+
+		if i >= len(prevSchedule.Channels) {
+			return t
+		}
+
+		finishTime := prevSchedule.Channels[i].FinishTime()
+		if finishTime.Before(t) {
+			return t
+		}
+
+		return finishTime
+	}
+
+	getPrevChannel := func(i int) *Channel {
+		if prevSchedule != nil && i < len(prevSchedule.Channels) {
+			return &prevSchedule.Channels[i]
+		}
+		return nil
+	}
+
+	// プレイリストのチャンネルは並びが決まっているので先に作成して、他のチャンネルで同じ時間にかぶらないようにする
+	opts := source.opts
+	channels := make([]Channel, opts.ChannelCount)
+	created := make([]bool, opts.ChannelCount)
+	others := make([]Channel, 0, opts.ChannelCount)
+	for i := 0; i < opts.ChannelCount; i++ {
+		id := opts.channelPlaylist(i)
+		if id == "" {
+			continue
+		}
+
+		p, ok := source.Playlist(id)
+		if !ok {
+			metrics.SchedulerRejections.WithLabelValues("playlist_unavailable").Inc()
+			logging.Warning(ctx, "playlist is not exported, create random channel", logging.Fields{
+				"channel":    i + 1,
+				"playlistId": id,
+			})
+			continue
+		}
+
+		channel, err := createPlaylistChannel(p, getPrevChannel(i), getStartTime(i))
+		if err != nil {
+			metrics.SchedulerRejections.WithLabelValues("playlist_unavailable").Inc()
+			logging.Warning(ctx, "can't create playlist channel, create random channel", logging.Fields{
+				"channel":    i + 1,
+				"playlistId": id,
+				"error":      err,
+			})
+			continue
+		}
+
+		channels[i] = channel
+		created[i] = true
+		others = append(others, channel)
+	}
+
+	for i := 0; i < opts.ChannelCount; i++ {
+		if created[i] {
+			continue
+		}
+
+		var slotTime time.Time
+		if opts.Series.Mode == SeriesModeDaily && i == opts.Series.Channel {
+			slotTime = seriesSlotTime(t, opts.Series.Slot)
+		}
+
+		channel, err := createChannelWithFallback(ctx, source, getPrevChannel(i), getStartTime(i), others, slotTime)
+		if err != nil {
+			return Schedule{}, ErrChannelGeneration{
+				Channel: i,
+				Err:     err,
+			}
+		}
+
+		channels[i] = channel
+		others = append(others, channel)
+	}
+
+	return Schedule{
+		Channels:           channels,
+		seriesCursor:       source.series.snapshot(),
+		seriesCursorBefore: before,
+	}, nil
+}
+
+// forStore Firestoreに保存する形式にする
+func (s Schedule) forStore() (forStore, error) {
+	doc := forStore{
+		SeriesCursorBefore: s.seriesCursorBefore,
+	}
+	slots := doc.channelSlots()
+	for i := range s.Channels {
+		data, err := json.Marshal(s.Channels[i])
+		if err != nil {
+			return forStore{}, err
+		}
+		*slots[i] = data
+	}
+
+	return doc, nil
+}
+
+// Save dayの日付のスケジュールとして保存する
+// 検査でエラーが見つかったスケジュールは保存しない
+// 作成したときに進めたシリーズのカーソルも一緒に保存する
+func Save(ctx context.Context, storeClient *firestore.Client, lock *lease.Lock, day time.Time, s Schedule, report Report) error {
+	if len(s.Channels) == 0 || len(s.Channels) > MaxChannelCount {
+		metrics.SchedulerRejections.WithLabelValues("empty_schedule").Inc()
+		return ErrEmpty{}
+	}
+	for _, c := range s.Channels {
+		if len(c.Items) == 0 {
+			metrics.SchedulerRejections.WithLabelValues("empty_schedule").Inc()
+			return ErrEmpty{}
+		}
+	}
+
+	if report.HasError() {
+		metrics.SchedulerRejections.WithLabelValues("invalid_schedule").Inc()
+		return ErrInvalid{
+			Report: report,
+		}
+	}
+
+	key := broadcast.Key(day)
+	doc, err := s.forStore()
+	if err != nil {
+		return err
+	}
+	// ロックを失っている場合は他のジョブが同じ日付のスケジュールを作成している可能性がある
+	err = lock.RunFenced(ctx, func(tx *firestore.Transaction) error {
+		err := tx.Set(storeClient.Collection("Schedule").Doc(key), doc)
+		if err != nil || s.seriesCursor == nil {
+			return err
+		}
+
+		cursor := *s.seriesCursor
+		cursor.UpdatedAt = time.Now()
+		return tx.Set(seriesCursorDoc(storeClient), cursor)
+	})
+	if err != nil {
+		return err
+	}
+	Invalidate(key)
+	jobrun.FromContext(ctx).AddScheduleDate(key)
+	logging.Info(ctx, "export schedule", logging.Fields{
+		"date": key,
+	})
+
+	return nil
+}
+
+// ErrLaterSchedule 後の日付のスケジュールがシリーズの続きから作成されているので、カーソルを戻せない
+type ErrLaterSchedule struct {
+	Date string
+}
+
+func (e ErrLaterSchedule) Error() string {
+	return fmt.Sprintf("schedule %v is created after this schedule", e.Date)
+}
+
+// storedSchedule 日付と保存されているスケジュール
+type storedSchedule struct {
+	Key string
+	Doc forStore
+}
+
+// cursorToRestore docのスケジュールを削除したときに戻すシリーズのカーソル、戻さない場合はnil
+// laterは後の日付のスケジュールで、シリーズの続きから作成されているものがある場合はErrLaterScheduleを返す
+func cursorToRestore(doc forStore, later []storedSchedule) (*SeriesCursor, error) {
+	if doc.SeriesCursorBefore == nil {
+		return nil, nil
+	}
+
+	for _, s := range later {
+		if s.Doc.SeriesCursorBefore != nil {
+			return nil, ErrLaterSchedule{Date: s.Key}
+		}
+	}
+
+	cursor := doc.SeriesCursorBefore.clone()
+	return &cursor, nil
+}
+
+// Delete dayの日付のスケジュールを削除する
+// 作成したときにシリーズのカーソルを進めていた場合は作成する前のカーソルに戻す
+func Delete(ctx context.Context, storeClient *firestore.Client, day time.Time) error {
+	key := broadcast.Key(day)
+	ref := storeClient.Collection("Schedule").Doc(key)
+	err := storeClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		metrics.CountFirestoreReads("schedule", 1)
+		snap, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var doc forStore
+		err = snap.DataTo(&doc)
+		if err != nil {
+			return err
+		}
+		if doc.SeriesCursorBefore == nil {
+			return tx.Delete(ref)
+		}
+
+		snaps, err := tx.Documents(storeClient.Collection("Schedule").Where(firestore.DocumentID, ">", ref)).GetAll()
+		if err != nil {
+			return err
+		}
+		later := make([]storedSchedule, 0, len(snaps))
+		for _, snap := range snaps {
+			metrics.CountFirestoreReads("schedule", 1)
+			var d forStore
+			err = snap.DataTo(&d)
+			if err != nil {
+				return err
+			}
+			later = append(later, storedSchedule{Key: snap.Ref.ID, Doc: d})
+		}
+
+		cursor, err := cursorToRestore(doc, later)
+		if err != nil {
+			return err
+		}
+		cursor.UpdatedAt = time.Now()
+		err = tx.Set(seriesCursorDoc(storeClient), *cursor)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return err
+	}
+	Invalidate(key)
+
+	return nil
+}
+
+// CheckLatest dayより後の日付のスケジュールが作成済みであればErrLaterScheduleを返す
+// 後の日付のスケジュールはdayのスケジュールから続くように作成されている
+func CheckLatest(ctx context.Context, storeClient *firestore.Client, day time.Time) error {
+	ref := storeClient.Collection("Schedule").Doc(broadcast.Key(day))
+	snaps, err := storeClient.Collection("Schedule").
+		Where(firestore.DocumentID, ">", ref).
+		OrderBy(firestore.DocumentID, firestore.Desc).
+		Select().
+		Limit(1).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return err
+	}
+	metrics.CountFirestoreReads("schedule", len(snaps))
+	if len(snaps) > 0 {
+		return ErrLaterSchedule{Date: snaps[0].Ref.ID}
+	}
+
+	return nil
+}
+
+// Export 明日のスケジュールを作成する
+// 同時に実行されると同じ日付のスケジュールを両方が作成してしまうので、ロックを取得してから行う
+func Export(ctx context.Context, storeClient *firestore.Client, opts Options) error {
+	lock, err := lease.AcquireLock(ctx, storeClient, "export-schedule", lease.ExportTTL)
+	if _, ok := err.(lease.ErrLockHeld); ok {
+		logging.Info(ctx, "export schedule is running on another job", nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	today := broadcast.Today()
+	tommorow := broadcast.NextDay(today)
+
+	_, err = Get(ctx, storeClient, tommorow, opts)
+	// 明日のスケジュールが既に作成されている場合は何もしない
+	if err == nil || status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	todaySchedule, err := Get(ctx, storeClient, today, opts)
+	notFound := status.Code(err) == codes.NotFound
+	if err != nil && !notFound {
+		return err
+	}
+
+	source, err := NewVideoSource(ctx, storeClient, opts)
+	if err != nil {
+		return err
+	}
+
+	// 今日のスケジュールが存在しない
+	if notFound {
+		todaySchedule, err = Create(ctx, source, nil, today)
+		if err != nil {
+			return err
+		}
+		report := Validate(todaySchedule, nil, today, source.Index(), opts)
+		LogReport(ctx, report)
+		err = Save(ctx, storeClient, lock, today, todaySchedule, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	tommorowSchedule, err := Create(ctx, source, &todaySchedule, tommorow)
+	if err != nil {
+		return err
+	}
+	report := Validate(tommorowSchedule, &todaySchedule, tommorow, source.Index(), opts)
+	LogReport(ctx, report)
+
+	return Save(ctx, storeClient, lock, tommorow, tommorowSchedule, report)
+}
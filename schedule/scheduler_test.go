@@ -0,0 +1,305 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+)
+
+// testVideos 同じ長さの動画をcount本
+func testVideos(prefix string, count int, duration time.Duration) []library.IndexEntry {
+	videos := make([]library.IndexEntry, count)
+	for i := range videos {
+		videos[i] = library.IndexEntry{ID: fmt.Sprintf("%v%v", prefix, i), Duration: duration}
+	}
+	return videos
+}
+
+// checkFilled 番組がstartから隙間なく並び、次の放送日の開始時刻まで埋まっているか
+func checkFilled(t *testing.T, name string, c Channel, start time.Time) {
+	nextDay := broadcast.NextDay(start)
+	if len(c.Items) == 0 {
+		t.Errorf("%v: channel is empty", name)
+		return
+	}
+
+	current := start
+	for i, it := range c.Items {
+		if !it.Time.Equal(current) {
+			t.Errorf("%v: item %v starts at %v, want %v", name, i, it.Time, current)
+			return
+		}
+		current = current.Add(it.Duration)
+	}
+
+	last := c.Items[len(c.Items)-1]
+	if !last.Time.Before(nextDay) || current.Before(nextDay) {
+		t.Errorf("%v: last item %v-%v does not reach the next day %v", name, last.Time, current, nextDay)
+	}
+}
+
+func TestCreateChannel(t *testing.T) {
+	day := broadcast.DayAt(2020, 1, 1)
+	// 他のチャンネルでは1日中x0を放送している
+	other := Channel{Items: []Item{{Time: day, Duration: 24 * time.Hour, VideoID: "x0"}}}
+
+	tests := []struct {
+		name        string
+		videos      []library.IndexEntry
+		start       time.Time
+		other       []Channel
+		constraints channelConstraints
+		// exact 次の放送日の開始時刻ちょうどで終わる
+		exact bool
+		err   error
+	}{
+		{
+			name:        "fill exactly to the next day",
+			videos:      testVideos("v", 100, 20*time.Minute),
+			start:       day,
+			constraints: strictConstraints,
+			exact:       true,
+		},
+		{
+			// 前日の最後の番組が延びた場合は途中から始まり、最後の番組は次の放送日にはみ出す
+			name:        "continue from the previous day",
+			videos:      testVideos("v", 100, 20*time.Minute),
+			start:       day.Add(7 * time.Minute),
+			constraints: strictConstraints,
+		},
+		{
+			name:        "skip long and unknown duration videos",
+			videos:      append(append(testVideos("v", 100, 20*time.Minute), testVideos("long", 10, time.Hour)...), testVideos("unknown", 10, 0)...),
+			start:       day,
+			constraints: strictConstraints,
+			exact:       true,
+		},
+		{
+			name:        "exclude simultaneous videos",
+			videos:      append(testVideos("v", 100, 20*time.Minute), testVideos("x", 1, 20*time.Minute)...),
+			start:       day,
+			other:       []Channel{other},
+			constraints: strictConstraints,
+			exact:       true,
+		},
+		{
+			// 1日分に足りない場合はかぶりなしでは作成できない
+			name:        "pool exhausted",
+			videos:      testVideos("v", 10, 20*time.Minute),
+			start:       day,
+			constraints: strictConstraints,
+			err:         ErrCanNotFetchVideo{},
+		},
+		{
+			name:        "only long videos",
+			videos:      testVideos("long", 100, time.Hour),
+			start:       day,
+			constraints: strictConstraints,
+			err:         ErrCanNotFetchVideo{},
+		},
+		{
+			name:        "repeat when relaxed",
+			videos:      testVideos("v", 10, 20*time.Minute),
+			start:       day,
+			constraints: channelConstraints{noLong: true},
+			exact:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		source := testVideoSource(DefaultOptions(), tt.videos, nil)
+		c, err := createChannel(source, tt.start, tt.other, tt.constraints, time.Time{})
+		if tt.err != nil {
+			if err != tt.err {
+				t.Errorf("%v: createChannel returned %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: createChannel returned error: %v", tt.name, err)
+			continue
+		}
+
+		checkFilled(t, tt.name, c, tt.start)
+		if tt.exact {
+			if end := c.FinishTime(); !end.Equal(broadcast.NextDay(day)) {
+				t.Errorf("%v: channel finishes at %v, want %v", tt.name, end, broadcast.NextDay(day))
+			}
+		}
+
+		seen := map[string]struct{}{}
+		for i, it := range c.Items {
+			if it.Duration <= 0 || it.Duration >= source.opts.MaxVideoDuration {
+				t.Errorf("%v: item %v has duration %v", tt.name, i, it.Duration)
+			}
+			if id, err := other.VideoIDAt(it.Time); len(tt.other) > 0 && err == nil && id == it.VideoID {
+				t.Errorf("%v: item %v is simultaneous with the other channel", tt.name, i)
+			}
+			if _, ok := seen[it.VideoID]; ok && tt.constraints.noRepeat {
+				t.Errorf("%v: item %v is repeated: %v", tt.name, i, it.VideoID)
+			}
+			if i > 0 && c.Items[i-1].VideoID == it.VideoID {
+				t.Errorf("%v: item %v is the same as the previous item: %v", tt.name, i, it.VideoID)
+			}
+			seen[it.VideoID] = struct{}{}
+		}
+	}
+}
+
+func TestCreateChannelWithFallback(t *testing.T) {
+	day := broadcast.DayAt(2020, 1, 1)
+	prev := Channel{Items: []Item{
+		{Time: broadcast.PrevDay(day), Duration: 10 * time.Hour, VideoID: "p0"},
+		{Time: broadcast.PrevDay(day).Add(10 * time.Hour), Duration: 14 * time.Hour, VideoID: "p1"},
+	}}
+
+	tests := []struct {
+		name   string
+		videos []library.IndexEntry
+		prev   *Channel
+		// reuse 前日のチャンネルを並べ直したものになる
+		reuse bool
+		// maxDuration 番組の長さの上限、0の場合は確認しない
+		maxDuration time.Duration
+		err         error
+	}{
+		{
+			name:        "strict",
+			videos:      testVideos("v", 100, 20*time.Minute),
+			prev:        &prev,
+			maxDuration: 30 * time.Minute,
+		},
+		{
+			// かぶりなしで足りない場合は同じ動画を繰り返す
+			name:        "not enough videos",
+			videos:      testVideos("v", 10, 20*time.Minute),
+			prev:        &prev,
+			maxDuration: 30 * time.Minute,
+		},
+		{
+			// 長い動画しかない場合は最後に長さの制約を緩める
+			name:   "only long videos",
+			videos: testVideos("long", 3, time.Hour),
+			prev:   &prev,
+		},
+		{
+			name:  "reuse the previous channel",
+			prev:  &prev,
+			reuse: true,
+		},
+		{
+			name: "no previous channel",
+			err:  ErrCanNotFetchVideo{},
+		},
+	}
+
+	for _, tt := range tests {
+		source := testVideoSource(DefaultOptions(), tt.videos, nil)
+		c, err := createChannelWithFallback(context.Background(), source, tt.prev, day, nil, time.Time{})
+		if tt.err != nil {
+			if err != tt.err {
+				t.Errorf("%v: createChannelWithFallback returned %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: createChannelWithFallback returned error: %v", tt.name, err)
+			continue
+		}
+
+		checkFilled(t, tt.name, c, day)
+		for i, it := range c.Items {
+			if tt.maxDuration > 0 && it.Duration > tt.maxDuration {
+				t.Errorf("%v: item %v has duration %v", tt.name, i, it.Duration)
+			}
+			if (it.VideoID == "p0" || it.VideoID == "p1") != tt.reuse {
+				t.Errorf("%v: item %v is %v", tt.name, i, it.VideoID)
+			}
+		}
+		if tt.reuse {
+			want, _ := reuseChannel(prev, day)
+			if !reflect.DeepEqual(c, want) {
+				t.Errorf("%v: channel = %v, want %v", tt.name, c, want)
+			}
+		}
+	}
+}
+
+func TestReuseChannel(t *testing.T) {
+	day := broadcast.DayAt(2020, 1, 1)
+	item := func(id string, minutes int) Item {
+		return Item{Time: broadcast.PrevDay(day), Duration: time.Duration(minutes) * time.Minute, VideoID: id}
+	}
+	ids := func(c Channel) []string {
+		var ids []string
+		for _, it := range c.Items {
+			ids = append(ids, it.VideoID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name  string
+		prev  Channel
+		start time.Time
+		want  []string
+		err   error
+	}{
+		{
+			name:  "fill exactly to the next day",
+			prev:  Channel{Items: []Item{item("a", 8*60), item("b", 8*60), item("c", 8*60)}},
+			start: day,
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			// 足りない場合は最初から繰り返す
+			name:  "repeat the previous channel",
+			prev:  Channel{Items: []Item{item("a", 10*60), item("b", 4*60)}},
+			start: day,
+			want:  []string{"a", "b", "a"},
+		},
+		{
+			name:  "skip items without duration",
+			prev:  Channel{Items: []Item{item("a", 0), item("b", 12*60)}},
+			start: day.Add(time.Hour),
+			want:  []string{"b", "b"},
+		},
+		{
+			// 前日が長くても次の放送日の開始時刻を過ぎたら終わる
+			name:  "stop at the next day",
+			prev:  Channel{Items: []Item{item("a", 20*60), item("b", 20*60)}},
+			start: day,
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "empty",
+			prev:  Channel{Items: []Item{item("a", 0)}},
+			start: day,
+			err:   ErrNoPrevChannel{},
+		},
+	}
+
+	for _, tt := range tests {
+		c, err := reuseChannel(tt.prev, tt.start)
+		if tt.err != nil {
+			if err != tt.err {
+				t.Errorf("%v: reuseChannel returned %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: reuseChannel returned error: %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(ids(c), tt.want) {
+			t.Errorf("%v: items = %v, want %v", tt.name, ids(c), tt.want)
+		}
+		checkFilled(t, tt.name, c, tt.start)
+	}
+}
@@ -0,0 +1,302 @@
+// シリーズを話数の順に放送する編成
+// block: ランダムに選んだ動画がシリーズの1話だった場合は、その代わりに続きから最大BlockSize話を続けて放送する、シリーズの最後の話で終わる
+// daily: ChannelでSlotの時刻を過ぎた最初の番組として、1つのシリーズを毎日1話ずつ放送する
+// どこまで放送したかはシリーズごとのカーソルとしてInfo/SeriesCursorに保存して、次のスケジュールの作成で続きから放送する
+package schedule
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+const (
+	SeriesModeOff   = "off"
+	SeriesModeBlock = "block"
+	SeriesModeDaily = "daily"
+)
+
+// SeriesOptions シリーズの編成の設定
+type SeriesOptions struct {
+	// Mode off, block, daily
+	Mode string
+	// BlockSize blockの場合に続けて放送する話数
+	BlockSize int
+	// Slot dailyの場合に放送する時刻の0時からの時間
+	Slot time.Duration
+	// Channel dailyの場合に放送するチャンネル(0から)
+	Channel int
+}
+
+// SeriesEpisode シリーズで最後に放送した話
+type SeriesEpisode struct {
+	VideoID string `firestore:"videoId" json:"videoId"`
+	Number  int    `firestore:"number" json:"number"`
+}
+
+// SeriesCursor Info/SeriesCursorに保存する
+type SeriesCursor struct {
+	// Last シリーズごとの最後に放送した話
+	// シリーズが作り直されて話の位置が変わっても続きを探せるように、位置ではなく動画と話数を保存する
+	Last map[string]SeriesEpisode `firestore:"last" json:"last"`
+	// Daily dailyで放送中のシリーズ、最後まで放送したら空にして次のシリーズを選ぶ
+	Daily     string    `firestore:"daily" json:"daily"`
+	UpdatedAt time.Time `firestore:"updatedAt" json:"updatedAt"`
+}
+
+func (c SeriesCursor) clone() SeriesCursor {
+	last := make(map[string]SeriesEpisode, len(c.Last))
+	for id, e := range c.Last {
+		last[id] = e
+	}
+	c.Last = last
+	return c
+}
+
+// Position シリーズの次に放送する話の位置
+// 最後に放送した動画が見つからない場合は話数がそれより大きい最初の話、最後まで放送した場合は最初に戻る
+func (c SeriesCursor) Position(s library.Series) int {
+	last, ok := c.Last[s.ID]
+	if !ok {
+		return 0
+	}
+
+	for i, e := range s.Episodes {
+		if e.VideoID == last.VideoID {
+			if i+1 < len(s.Episodes) {
+				return i + 1
+			}
+			return 0
+		}
+	}
+	for i, e := range s.Episodes {
+		if e.Number > last.Number {
+			return i
+		}
+	}
+	return 0
+}
+
+func seriesCursorDoc(storeClient *firestore.Client) *firestore.DocumentRef {
+	return storeClient.Collection("Info").Doc("SeriesCursor")
+}
+
+// LoadSeriesCursor 保存されているカーソルを読み込む
+// 保存されていない場合はすべてのシリーズを最初から放送する
+func LoadSeriesCursor(ctx context.Context, storeClient *firestore.Client) (SeriesCursor, error) {
+	metrics.CountFirestoreReads("series_cursor", 1)
+	snap, err := seriesCursorDoc(storeClient).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return SeriesCursor{Last: map[string]SeriesEpisode{}}, nil
+		}
+		return SeriesCursor{}, err
+	}
+
+	var c SeriesCursor
+	err = snap.DataTo(&c)
+	if err != nil {
+		return SeriesCursor{}, err
+	}
+	if c.Last == nil {
+		c.Last = map[string]SeriesEpisode{}
+	}
+	return c, nil
+}
+
+// seriesPlanner スケジュールの作成中にシリーズの続きを管理する
+// Modeがoffの場合はnilで、nilのまま呼び出してもよい
+type seriesPlanner struct {
+	opts   SeriesOptions
+	series map[string]library.Series
+	// ids 選ぶ順番が毎回同じになるように並べておく
+	ids      []string
+	seriesOf map[string]string
+	cursor   SeriesCursor
+}
+
+// loadSeriesPlanner タイトルから見つけたシリーズと、チャンネルに割り当てていないソースのプレイリストを読み込む
+func loadSeriesPlanner(ctx context.Context, storeClient *firestore.Client, playlists map[string]library.Playlist, opts Options) (*seriesPlanner, error) {
+	if opts.Series.Mode == SeriesModeOff {
+		return nil, nil
+	}
+
+	found, err := library.LoadSeries(ctx, storeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := map[string]struct{}{}
+	for _, id := range opts.ChannelPlaylists {
+		assigned[id] = struct{}{}
+	}
+	for _, id := range opts.PlaylistIDs {
+		if _, ok := assigned[id]; ok {
+			continue
+		}
+		if p, ok := playlists[id]; ok {
+			found = append(found, library.PlaylistSeries(p))
+		}
+	}
+
+	cursor, err := LoadSeriesCursor(ctx, storeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSeriesPlanner(found, cursor, opts.Series), nil
+}
+
+// newSeriesPlanner 2話以上あるシリーズをcursorの続きから放送する
+func newSeriesPlanner(found []library.Series, cursor SeriesCursor, opts SeriesOptions) *seriesPlanner {
+	p := &seriesPlanner{
+		opts:     opts,
+		series:   map[string]library.Series{},
+		seriesOf: map[string]string{},
+		cursor:   cursor,
+	}
+	for _, s := range found {
+		if len(s.Episodes) < 2 {
+			continue
+		}
+		if _, ok := p.series[s.ID]; ok {
+			continue
+		}
+
+		p.series[s.ID] = s
+		p.ids = append(p.ids, s.ID)
+		// 複数のシリーズに含まれる動画は先に見つかった方にする
+		for _, e := range s.Episodes {
+			if _, ok := p.seriesOf[e.VideoID]; !ok {
+				p.seriesOf[e.VideoID] = s.ID
+			}
+		}
+	}
+	sort.Strings(p.ids)
+
+	return p
+}
+
+// save 作成に失敗したときに戻せるようにカーソルを複製しておく
+func (p *seriesPlanner) save() SeriesCursor {
+	if p == nil {
+		return SeriesCursor{}
+	}
+	return p.cursor.clone()
+}
+
+func (p *seriesPlanner) restore(c SeriesCursor) {
+	if p == nil {
+		return
+	}
+	p.cursor = c.clone()
+}
+
+// snapshot Saveで保存するカーソル
+func (p *seriesPlanner) snapshot() *SeriesCursor {
+	if p == nil {
+		return nil
+	}
+	c := p.cursor.clone()
+	return &c
+}
+
+// upcoming シリーズの続きの話を最後の話まで返す、途中で最初には戻らない
+func (p *seriesPlanner) upcoming(s library.Series) []library.Episode {
+	return s.Episodes[p.cursor.Position(s):]
+}
+
+// advance eまで放送したとしてカーソルを進める
+// dailyで放送中のシリーズを最後まで放送したら、放送する前から他の番組で流れないようにすぐに次のシリーズを選ぶ
+func (p *seriesPlanner) advance(r *rand.Rand, s library.Series, e library.Episode) {
+	p.cursor.Last[s.ID] = SeriesEpisode{
+		VideoID: e.VideoID,
+		Number:  e.Number,
+	}
+
+	if s.ID == p.cursor.Daily && e.VideoID == s.Episodes[len(s.Episodes)-1].VideoID {
+		p.cursor.Daily = ""
+		p.chooseDaily(r, s.ID)
+	}
+}
+
+// excludeDaily dailyで放送中のシリーズの動画はランダムに選ばないようにする
+func (p *seriesPlanner) excludeDaily(excludeIDs map[string]struct{}) {
+	if p == nil || p.opts.Mode != SeriesModeDaily {
+		return
+	}
+
+	for _, e := range p.series[p.cursor.Daily].Episodes {
+		excludeIDs[e.VideoID] = struct{}{}
+	}
+}
+
+// blockSeries blockの場合にvideoIDの動画を含むシリーズを返す
+func (p *seriesPlanner) blockSeries(videoID string) (library.Series, bool) {
+	if p == nil || p.opts.Mode != SeriesModeBlock {
+		return library.Series{}, false
+	}
+
+	id, ok := p.seriesOf[videoID]
+	if !ok {
+		return library.Series{}, false
+	}
+	return p.series[id], true
+}
+
+// chooseDaily dailyで放送中のシリーズがない、もしくはなくなった場合は別のシリーズをランダムに選んで最初から放送する
+// 他にシリーズがあればfinishedのシリーズは選ばない
+func (p *seriesPlanner) chooseDaily(r *rand.Rand, finished string) {
+	if p == nil || p.opts.Mode != SeriesModeDaily || len(p.ids) == 0 {
+		return
+	}
+	if _, ok := p.series[p.cursor.Daily]; ok {
+		return
+	}
+
+	candidates := p.ids
+	if len(p.ids) > 1 && finished != "" {
+		candidates = make([]string, 0, len(p.ids)-1)
+		for _, id := range p.ids {
+			if id != finished {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+
+	id := candidates[r.Intn(len(candidates))]
+	p.cursor.Daily = id
+	delete(p.cursor.Last, id)
+}
+
+// dailySeries dailyで放送中のシリーズ
+func (p *seriesPlanner) dailySeries(r *rand.Rand) (library.Series, bool) {
+	p.chooseDaily(r, "")
+	if p == nil || p.cursor.Daily == "" {
+		return library.Series{}, false
+	}
+	return p.series[p.cursor.Daily], true
+}
+
+// seriesSlotTime 放送日tのslotの時刻
+// 放送日の開始時刻より前の時刻は翌日の時刻とする
+func seriesSlotTime(t time.Time, slot time.Duration) time.Time {
+	dayStart := broadcast.DayStart(t)
+	hour := int(slot / time.Hour)
+	minute := int(slot % time.Hour / time.Minute)
+	result := time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), hour, minute, 0, 0, broadcast.Location)
+	if result.Before(dayStart) {
+		result = time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day()+1, hour, minute, 0, 0, broadcast.Location)
+	}
+
+	return result
+}
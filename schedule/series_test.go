@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+)
+
+// testVideoSource videosを候補にして、seriesがある場合はシリーズを編成するVideoSource
+func testVideoSource(opts Options, videos []library.IndexEntry, series []library.Series) *VideoSource {
+	vs := &VideoSource{
+		opts:   opts,
+		r:      rand.New(rand.NewSource(1)),
+		videos: videos,
+	}
+	if opts.Series.Mode != SeriesModeOff {
+		vs.series = newSeriesPlanner(series, SeriesCursor{Last: map[string]SeriesEpisode{}}, opts.Series)
+		vs.series.chooseDaily(vs.r, "")
+	}
+	return vs
+}
+
+// testSeries 20分の話がcount話あるシリーズと、その動画
+func testSeries(count int) (library.Series, []library.IndexEntry) {
+	s := library.Series{ID: "title:test"}
+	var videos []library.IndexEntry
+	for i := 1; i <= count; i++ {
+		id := fmt.Sprintf("e%v", i)
+		s.Episodes = append(s.Episodes, library.Episode{VideoID: id, Number: i, Duration: 20 * time.Minute})
+		videos = append(videos, library.IndexEntry{ID: id, Duration: 20 * time.Minute})
+	}
+	return s, videos
+}
+
+func TestSeriesCursorPosition(t *testing.T) {
+	s := library.Series{
+		ID: "title:test",
+		Episodes: []library.Episode{
+			{VideoID: "e1", Number: 1},
+			{VideoID: "e2", Number: 2},
+			{VideoID: "e4", Number: 4},
+		},
+	}
+
+	tests := []struct {
+		name string
+		last *SeriesEpisode
+		want int
+	}{
+		{"not aired", nil, 0},
+		{"after the first episode", &SeriesEpisode{VideoID: "e1", Number: 1}, 1},
+		{"after the last episode", &SeriesEpisode{VideoID: "e4", Number: 4}, 0},
+		// 最後に放送した動画が削除された場合は話数で続きを探す
+		{"removed episode", &SeriesEpisode{VideoID: "e3", Number: 3}, 2},
+		{"removed last episode", &SeriesEpisode{VideoID: "e5", Number: 5}, 0},
+		// 話数が変わっていても動画が見つかればその続き
+		{"renumbered episode", &SeriesEpisode{VideoID: "e2", Number: 10}, 2},
+	}
+
+	for _, tt := range tests {
+		c := SeriesCursor{Last: map[string]SeriesEpisode{}}
+		if tt.last != nil {
+			c.Last[s.ID] = *tt.last
+		}
+		if got := c.Position(s); got != tt.want {
+			t.Errorf("%v: Position = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSeriesCursorBeforeEachDay(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ChannelCount = 1
+	opts.Series.Mode = SeriesModeBlock
+	// すべての動画がシリーズの話なので、1日目と2日目で続きの話を放送する
+	s, videos := testSeries(200)
+	source := testVideoSource(opts, videos, []library.Series{s})
+
+	ctx := context.Background()
+	today := broadcast.DayAt(2020, 1, 1)
+	tomorrow := broadcast.NextDay(today)
+	todaySchedule, err := Create(ctx, source, nil, today)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	tomorrowSchedule, err := Create(ctx, source, &todaySchedule, tomorrow)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	// Exportと同じく同じVideoSourceで2日分作成しても、2日目の作成前のカーソルは1日目の作成後のカーソル
+	if !reflect.DeepEqual(tomorrowSchedule.seriesCursorBefore, todaySchedule.seriesCursor) {
+		t.Fatalf("cursor before tomorrow = %+v, want %+v", tomorrowSchedule.seriesCursorBefore, todaySchedule.seriesCursor)
+	}
+	if last := todaySchedule.seriesCursor.Last[s.ID]; last.VideoID == "" {
+		t.Fatalf("series is not aired today")
+	}
+
+	todayDoc, err := todaySchedule.forStore()
+	if err != nil {
+		t.Fatalf("forStore returned error: %v", err)
+	}
+	tomorrowDoc, err := tomorrowSchedule.forStore()
+	if err != nil {
+		t.Fatalf("forStore returned error: %v", err)
+	}
+
+	// 2日目を削除すると1日目に放送した話の続きに戻る
+	cursor, err := cursorToRestore(tomorrowDoc, nil)
+	if err != nil {
+		t.Fatalf("cursorToRestore returned error: %v", err)
+	}
+	if !reflect.DeepEqual(cursor.Last, todaySchedule.seriesCursor.Last) {
+		t.Errorf("restored cursor = %+v, want %+v", cursor.Last, todaySchedule.seriesCursor.Last)
+	}
+
+	// 2日目が残っている間は1日目を削除できない
+	_, err = cursorToRestore(todayDoc, []storedSchedule{{Key: broadcast.Key(tomorrow), Doc: tomorrowDoc}})
+	if e, ok := err.(ErrLaterSchedule); !ok || e.Date != broadcast.Key(tomorrow) {
+		t.Errorf("cursorToRestore returned %v, want ErrLaterSchedule", err)
+	}
+}
@@ -0,0 +1,300 @@
+// 作成したスケジュールがルールを守っているかの検査と統計
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/logging"
+)
+
+// IssueKind 検査で見つかった問題の種類
+type IssueKind string
+
+const (
+	// IssueEmpty チャンネルに番組が1つもない
+	IssueEmpty IssueKind = "empty"
+	// IssueGap 前の番組の終了から次の番組の開始まで空きがある
+	IssueGap IssueKind = "gap"
+	// IssueOverlap 前の番組の終了前に次の番組が始まる
+	IssueOverlap IssueKind = "overlap"
+	// IssueContinuity 前日の最後の番組の終了時刻から始まっていない
+	IssueContinuity IssueKind = "continuity"
+	// IssueIncomplete 翌日の開始まで番組が埋まっていない
+	IssueIncomplete IssueKind = "incomplete"
+	// IssueUnavailable ライブラリに存在しない動画
+	IssueUnavailable IssueKind = "unavailable"
+	// IssueSimultaneous 同じ時間に別のチャンネルで同じ動画が流れている
+	IssueSimultaneous IssueKind = "simultaneous"
+	// IssueRepeat 1つのチャンネルで同じ日に同じ動画が流れている
+	IssueRepeat IssueKind = "repeat"
+	// IssueTooLong Options.MaxVideoDuration以上の動画
+	IssueTooLong IssueKind = "too-long"
+)
+
+// Severity 問題の重大度、エラーがあるスケジュールは保存しない
+type Severity string
+
+const (
+	// SeverityError 再生に支障がある
+	SeverityError Severity = "error"
+	// SeverityWarning 再生はできるが編成のルールを守っていない
+	SeverityWarning Severity = "warning"
+)
+
+var issueSeverities = map[IssueKind]Severity{
+	IssueEmpty:        SeverityError,
+	IssueGap:          SeverityError,
+	IssueOverlap:      SeverityError,
+	IssueContinuity:   SeverityError,
+	IssueIncomplete:   SeverityError,
+	IssueUnavailable:  SeverityError,
+	IssueSimultaneous: SeverityWarning,
+	IssueRepeat:       SeverityWarning,
+	IssueTooLong:      SeverityWarning,
+}
+
+// Issue 検査で見つかった問題、Channelは0から
+type Issue struct {
+	Kind     IssueKind
+	Severity Severity
+	Channel  int
+	Time     time.Time
+	VideoID  string
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("[%v] %v ch%v %v: %v", i.Severity, i.Kind, i.Channel+1, i.Time.In(broadcast.Location).Format("15:04:05"), i.Message)
+}
+
+type DurationBucket struct {
+	// Max このバケットに含まれる動画の長さの上限(この値は含まない)
+	// 0の場合は上限なし
+	Max   time.Duration
+	Count int
+}
+
+// Stats スケジュールの統計
+type Stats struct {
+	ItemCount    int
+	UniqueVideos int
+	// Diversity 番組数に対するユニークな動画の割合
+	Diversity float64
+	// AverageAge 放送日時点での動画の公開からの経過時間の平均
+	AverageAge        time.Duration
+	DurationHistogram []DurationBucket
+}
+
+// Report Validateの結果
+type Report struct {
+	Date   time.Time
+	Issues []Issue
+	Stats  Stats
+}
+
+// HasError SeverityErrorの問題が含まれているか
+func (r Report) HasError() bool {
+	for _, i := range r.Issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+var durationBucketMaxes = []time.Duration{
+	5 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	20 * time.Minute,
+	30 * time.Minute,
+	0,
+}
+
+// Validate dayの日付のスケジュールを検査する
+// prevScheduleは前日のスケジュールで、存在しない場合はnil
+func Validate(s Schedule, prevSchedule *Schedule, day time.Time, idx library.Index, opts Options) Report {
+	dayStart := broadcast.DayStart(day)
+	nextDay := broadcast.NextDay(dayStart)
+
+	report := Report{
+		Date: dayStart,
+	}
+	addIssue := func(kind IssueKind, ch int, t time.Time, videoID, message string) {
+		report.Issues = append(report.Issues, Issue{
+			Kind:     kind,
+			Severity: issueSeverities[kind],
+			Channel:  ch,
+			Time:     t,
+			VideoID:  videoID,
+			Message:  message,
+		})
+	}
+
+	videos := make(map[string]library.IndexEntry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		videos[e.ID] = e
+	}
+
+	histogram := make([]DurationBucket, len(durationBucketMaxes))
+	for i, max := range durationBucketMaxes {
+		histogram[i].Max = max
+	}
+
+	unique := map[string]struct{}{}
+	var totalAge time.Duration
+	ageCount := 0
+
+	// 作成されていないチャンネルも番組がないものとする
+	for i := len(s.Channels); i < opts.ChannelCount; i++ {
+		addIssue(IssueEmpty, i, dayStart, "", "no items")
+	}
+
+	for i, c := range s.Channels {
+		if len(c.Items) == 0 {
+			addIssue(IssueEmpty, i, dayStart, "", "no items")
+			continue
+		}
+
+		expectStart := dayStart
+		if prevSchedule != nil && i < len(prevSchedule.Channels) {
+			finishTime := prevSchedule.Channels[i].FinishTime()
+			if finishTime.After(dayStart) {
+				expectStart = finishTime
+			}
+		}
+		if first := c.Items[0]; !first.Time.Equal(expectStart) {
+			addIssue(IssueContinuity, i, first.Time, first.VideoID,
+				fmt.Sprintf("starts at %v, expected %v", first.Time.In(broadcast.Location).Format(time.RFC3339), expectStart.In(broadcast.Location).Format(time.RFC3339)))
+		}
+
+		played := map[string]struct{}{}
+		for j, it := range c.Items {
+			if j > 0 {
+				prevFinish := c.Items[j-1].Time.Add(c.Items[j-1].Duration)
+				if it.Time.After(prevFinish) {
+					addIssue(IssueGap, i, prevFinish, it.VideoID, fmt.Sprintf("%v gap", it.Time.Sub(prevFinish)))
+				} else if it.Time.Before(prevFinish) {
+					addIssue(IssueOverlap, i, it.Time, it.VideoID, fmt.Sprintf("%v overlap", prevFinish.Sub(it.Time)))
+				}
+			}
+
+			_, ok := played[it.VideoID]
+			if ok {
+				addIssue(IssueRepeat, i, it.Time, it.VideoID, it.VideoID+" is already played")
+			}
+			played[it.VideoID] = struct{}{}
+
+			if it.Duration >= opts.MaxVideoDuration {
+				addIssue(IssueTooLong, i, it.Time, it.VideoID, fmt.Sprintf("%v is %v", it.VideoID, it.Duration))
+			}
+
+			v, ok := videos[it.VideoID]
+			if !ok {
+				addIssue(IssueUnavailable, i, it.Time, it.VideoID, it.VideoID+" is not in the library")
+			} else {
+				totalAge += dayStart.Sub(v.PublishedAt)
+				ageCount++
+			}
+
+			for k := range histogram {
+				if histogram[k].Max == 0 || it.Duration < histogram[k].Max {
+					histogram[k].Count++
+					break
+				}
+			}
+
+			unique[it.VideoID] = struct{}{}
+			report.Stats.ItemCount++
+		}
+
+		if finishTime := c.FinishTime(); finishTime.Before(nextDay) {
+			addIssue(IssueIncomplete, i, finishTime, "", fmt.Sprintf("finishes %v before the next day", nextDay.Sub(finishTime)))
+		}
+	}
+
+	validateSimultaneous(s, addIssue)
+
+	report.Stats.UniqueVideos = len(unique)
+	if report.Stats.ItemCount > 0 {
+		report.Stats.Diversity = float64(len(unique)) / float64(report.Stats.ItemCount)
+	}
+	if ageCount > 0 {
+		report.Stats.AverageAge = totalAge / time.Duration(ageCount)
+	}
+	report.Stats.DurationHistogram = histogram
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Time.Before(report.Issues[j].Time)
+	})
+
+	return report
+}
+
+// validateSimultaneous 別のチャンネルで同じ動画が同時に流れていないか検査する
+func validateSimultaneous(s Schedule, addIssue func(IssueKind, int, time.Time, string, string)) {
+	type playing struct {
+		channel int
+		item    Item
+	}
+
+	byVideo := map[string][]playing{}
+	for i, c := range s.Channels {
+		for _, it := range c.Items {
+			byVideo[it.VideoID] = append(byVideo[it.VideoID], playing{
+				channel: i,
+				item:    it,
+			})
+		}
+	}
+
+	for id, ps := range byVideo {
+		for a := 0; a < len(ps); a++ {
+			for b := a + 1; b < len(ps); b++ {
+				x, y := ps[a], ps[b]
+				if x.channel == y.channel {
+					continue
+				}
+
+				xEnd := x.item.Time.Add(x.item.Duration)
+				yEnd := y.item.Time.Add(y.item.Duration)
+				if x.item.Time.Before(yEnd) && y.item.Time.Before(xEnd) {
+					addIssue(IssueSimultaneous, y.channel, y.item.Time, id,
+						fmt.Sprintf("%v is also played on ch%v", id, x.channel+1))
+				}
+			}
+		}
+	}
+}
+
+// LogReport 統計をログに出力して、問題は重大度に合わせたレベルで1件ずつ出力する
+func LogReport(ctx context.Context, report Report) {
+	logging.Info(ctx, "schedule report", logging.Fields{
+		"date":           broadcast.Key(report.Date),
+		"items":          report.Stats.ItemCount,
+		"uniqueVideos":   report.Stats.UniqueVideos,
+		"diversity":      report.Stats.Diversity,
+		"averageAgeDays": report.Stats.AverageAge.Hours() / 24,
+		"issues":         len(report.Issues),
+	})
+	for _, i := range report.Issues {
+		fields := logging.Fields{
+			"date":    broadcast.Key(report.Date),
+			"kind":    i.Kind,
+			"channel": i.Channel + 1,
+			"time":    i.Time,
+			"videoId": i.VideoID,
+		}
+		if i.Severity == SeverityError {
+			logging.Error(ctx, i.Message, fields)
+		} else {
+			logging.Warning(ctx, i.Message, fields)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package schedule
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/library"
+)
+
+const testItemDuration = 20 * time.Minute
+
+// testSchedule dayStartから翌日まで20分の動画で埋めたchannelCount個のチャンネル
+func testSchedule(dayStart time.Time, channelCount int) (Schedule, library.Index) {
+	var s Schedule
+	var idx library.Index
+	nextDay := broadcast.NextDay(dayStart)
+	for i := 0; i < channelCount; i++ {
+		var c Channel
+		for t := dayStart; t.Before(nextDay); t = t.Add(testItemDuration) {
+			id := fmt.Sprintf("ch%v-%v", i+1, len(c.Items))
+			c.Items = append(c.Items, Item{
+				Time:     t,
+				Duration: testItemDuration,
+				VideoID:  id,
+			})
+			idx.Entries = append(idx.Entries, library.IndexEntry{
+				ID:          id,
+				Duration:    testItemDuration,
+				PublishedAt: dayStart.AddDate(0, 0, -10),
+			})
+		}
+		s.Channels = append(s.Channels, c)
+	}
+
+	return s, idx
+}
+
+func TestValidate(t *testing.T) {
+	day := broadcast.DayAt(2020, 1, 1)
+	opts := DefaultOptions()
+	opts.ChannelCount = 2
+
+	tests := []struct {
+		name   string
+		modify func(s *Schedule)
+		prev   *Schedule
+		want   []IssueKind
+	}{
+		{
+			name:   "valid",
+			modify: func(s *Schedule) {},
+		},
+		{
+			name:   "empty channel",
+			modify: func(s *Schedule) { s.Channels[1].Items = nil },
+			want:   []IssueKind{IssueEmpty},
+		},
+		{
+			name:   "missing channel",
+			modify: func(s *Schedule) { s.Channels = s.Channels[:1] },
+			want:   []IssueKind{IssueEmpty},
+		},
+		{
+			name: "gap",
+			modify: func(s *Schedule) {
+				items := s.Channels[0].Items
+				s.Channels[0].Items = append(items[:5:5], items[6:]...)
+			},
+			want: []IssueKind{IssueGap},
+		},
+		{
+			name:   "overlap",
+			modify: func(s *Schedule) { s.Channels[0].Items[5].Duration += time.Minute },
+			want:   []IssueKind{IssueOverlap},
+		},
+		{
+			name:   "late start",
+			modify: func(s *Schedule) { s.Channels[0].Items = s.Channels[0].Items[1:] },
+			want:   []IssueKind{IssueContinuity},
+		},
+		{
+			name:   "continues from the previous day",
+			modify: func(s *Schedule) {},
+			// 前日の最後の番組が日付をまたいで終わる
+			prev: &Schedule{Channels: []Channel{{Items: []Item{{
+				Time:     day.Add(-testItemDuration / 2),
+				Duration: testItemDuration,
+				VideoID:  "prev",
+			}}}}},
+			want: []IssueKind{IssueContinuity},
+		},
+		{
+			name: "incomplete",
+			modify: func(s *Schedule) {
+				items := s.Channels[0].Items
+				s.Channels[0].Items = items[:len(items)-1]
+			},
+			want: []IssueKind{IssueIncomplete},
+		},
+		{
+			name:   "unavailable",
+			modify: func(s *Schedule) { s.Channels[0].Items[3].VideoID = "unknown" },
+			want:   []IssueKind{IssueUnavailable},
+		},
+		{
+			name:   "repeat",
+			modify: func(s *Schedule) { s.Channels[0].Items[3].VideoID = s.Channels[0].Items[1].VideoID },
+			want:   []IssueKind{IssueRepeat},
+		},
+		{
+			name: "too long",
+			modify: func(s *Schedule) {
+				items := s.Channels[0].Items
+				items[len(items)-1].Duration = opts.MaxVideoDuration
+			},
+			want: []IssueKind{IssueTooLong},
+		},
+		{
+			name:   "simultaneous",
+			modify: func(s *Schedule) { s.Channels[1].Items[0].VideoID = s.Channels[0].Items[0].VideoID },
+			want:   []IssueKind{IssueSimultaneous},
+		},
+		{
+			name:   "not simultaneous at different times",
+			modify: func(s *Schedule) { s.Channels[1].Items[0].VideoID = s.Channels[0].Items[1].VideoID },
+		},
+	}
+
+	for _, tt := range tests {
+		s, idx := testSchedule(day, opts.ChannelCount)
+		tt.modify(&s)
+
+		report := Validate(s, tt.prev, day, idx, opts)
+		var got []IssueKind
+		for _, i := range report.Issues {
+			got = append(got, i.Kind)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: issues = %v, want %v", tt.name, got, tt.want)
+		}
+
+		hasError := false
+		for _, kind := range tt.want {
+			if issueSeverities[kind] == SeverityError {
+				hasError = true
+			}
+		}
+		if report.HasError() != hasError {
+			t.Errorf("%v: HasError() = %v, want %v", tt.name, report.HasError(), hasError)
+		}
+	}
+}
+
+func TestValidateStats(t *testing.T) {
+	day := broadcast.DayAt(2020, 1, 1)
+	opts := DefaultOptions()
+	opts.ChannelCount = 2
+	s, idx := testSchedule(day, opts.ChannelCount)
+	// 1つのチャンネルの2番組を同じ動画にする
+	s.Channels[0].Items[1].VideoID = s.Channels[0].Items[0].VideoID
+
+	report := Validate(s, nil, day, idx, opts)
+	itemCount := 2 * int(24*time.Hour/testItemDuration)
+	if report.Stats.ItemCount != itemCount {
+		t.Errorf("ItemCount = %v, want %v", report.Stats.ItemCount, itemCount)
+	}
+	if report.Stats.UniqueVideos != itemCount-1 {
+		t.Errorf("UniqueVideos = %v, want %v", report.Stats.UniqueVideos, itemCount-1)
+	}
+	if report.Stats.AverageAge != 10*24*time.Hour {
+		t.Errorf("AverageAge = %v, want %v", report.Stats.AverageAge, 10*24*time.Hour)
+	}
+	for _, b := range report.Stats.DurationHistogram {
+		want := 0
+		if b.Max == 30*time.Minute {
+			want = itemCount
+		}
+		if b.Count != want {
+			t.Errorf("DurationHistogram[%v] = %v, want %v", b.Max, b.Count, want)
+		}
+	}
+}
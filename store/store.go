@@ -0,0 +1,52 @@
+// Firestoreのクライアント
+package store
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+)
+
+// ProjectID 接続するプロジェクト、設定ファイルのstorage.projectIdで変更する
+var ProjectID = "siro-4"
+
+var (
+	sharedClientMu sync.Mutex
+	sharedClient   *firestore.Client
+)
+
+// Shared プロセスで共有するFirestoreクライアントを取得する
+// 作成に失敗した場合は次の呼び出しで再度作成を試みる
+func Shared() (*firestore.Client, error) {
+	sharedClientMu.Lock()
+	defer sharedClientMu.Unlock()
+
+	if sharedClient != nil {
+		return sharedClient, nil
+	}
+
+	// リクエストのコンテキストに紐づけるとリクエスト終了時に使えなくなる
+	c, err := NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	sharedClient = c
+	return c, nil
+}
+
+// NewClient FIRESTORE_EMULATOR_HOSTが設定されている場合はエミュレーターに接続する
+func NewClient(ctx context.Context) (*firestore.Client, error) {
+	c, err := firestore.NewClient(ctx, ProjectID)
+	if err != nil {
+		logging.Error(ctx, "Error creating firestore client", logging.Fields{
+			"error": err,
+		})
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,154 @@
+// ISO 8601形式の期間
+// YouTube Data APIのcontentDetails.durationはPT1H2M3SやP1DT2H3Mの形式で返される
+package youtube
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ErrInvalidDuration struct {
+	Value  string
+	Reason string
+}
+
+func (e ErrInvalidDuration) Error() string {
+	return fmt.Sprintf("invalid duration %q: %v", e.Value, e.Reason)
+}
+
+type durationUnit struct {
+	designator byte
+	time       bool
+	// length 0の場合は長さが決まらないので受け付けない
+	length time.Duration
+}
+
+// durationUnits 指定できる順に並べる
+var durationUnits = []durationUnit{
+	{'Y', false, 0},
+	{'M', false, 0},
+	{'W', false, 7 * 24 * time.Hour},
+	{'D', false, 24 * time.Hour},
+	{'H', true, time.Hour},
+	{'M', true, time.Minute},
+	{'S', true, time.Second},
+}
+
+// ParseDuration ISO 8601形式の期間(PT1H2M3S、P1W、PT1.5Sなど)を変換する
+// 年と月は長さが決まらないので受け付けない
+// 小数は最後の要素にだけ指定できる
+func ParseDuration(value string) (time.Duration, error) {
+	invalid := func(reason string) (time.Duration, error) {
+		return 0, ErrInvalidDuration{Value: value, Reason: reason}
+	}
+
+	if !strings.HasPrefix(value, "P") {
+		return invalid("must start with P")
+	}
+
+	rest := value[1:]
+	inTime := false
+	next := 0
+	components := 0
+	hasFraction := false
+	var result time.Duration
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime {
+				return invalid("duplicate T")
+			}
+			inTime = true
+			rest = rest[1:]
+			if rest == "" {
+				return invalid("no time components after T")
+			}
+			continue
+		}
+		if hasFraction {
+			return invalid("fraction is allowed only in the last component")
+		}
+
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.' || rest[i] == ',') {
+			i++
+		}
+		if i == 0 {
+			return invalid(fmt.Sprintf("missing number before %q", rest[0]))
+		}
+		if i == len(rest) {
+			return invalid("missing designator")
+		}
+		number, designator := rest[:i], rest[i]
+		rest = rest[i+1:]
+
+		unit := -1
+		for j := next; j < len(durationUnits); j++ {
+			if durationUnits[j].designator == designator && durationUnits[j].time == inTime {
+				unit = j
+				break
+			}
+		}
+		if unit < 0 {
+			return invalid(fmt.Sprintf("unexpected designator %q", designator))
+		}
+		next = unit + 1
+
+		u := durationUnits[unit]
+		if u.length == 0 {
+			return invalid("years and months are not supported")
+		}
+
+		d, fraction, err := parseDurationComponent(number, u.length)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		if d > math.MaxInt64-result {
+			return invalid("too large")
+		}
+		result += d
+		hasFraction = fraction
+		components++
+	}
+
+	if components == 0 {
+		return invalid("no components")
+	}
+
+	return result, nil
+}
+
+// parseDurationComponent 1.5のような数値にunitを掛ける
+// 小数を含んでいた場合はtrueを返す
+func parseDurationComponent(number string, unit time.Duration) (time.Duration, bool, error) {
+	number = strings.Replace(number, ",", ".", 1)
+	intPart, fracPart := number, ""
+	if i := strings.IndexByte(number, '.'); i >= 0 {
+		intPart, fracPart = number[:i], number[i+1:]
+		if intPart == "" || fracPart == "" || strings.IndexAny(fracPart, ".,") >= 0 {
+			return 0, false, fmt.Errorf("invalid number %q", number)
+		}
+	}
+
+	n, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || n > int64(math.MaxInt64/unit) {
+		return 0, false, fmt.Errorf("invalid number %q", number)
+	}
+	result := time.Duration(n) * unit
+	if fracPart == "" {
+		return result, false, nil
+	}
+
+	f, err := strconv.ParseFloat("0."+fracPart, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number %q", number)
+	}
+	frac := time.Duration(math.Round(f * float64(unit)))
+	if frac > math.MaxInt64-result {
+		return 0, false, fmt.Errorf("invalid number %q", number)
+	}
+
+	return result + frac, true, nil
+}
@@ -0,0 +1,73 @@
+package youtube
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"PT0S", 0},
+		{"PT15S", 15 * time.Second},
+		{"PT1M", time.Minute},
+		{"PT1H2M3S", time.Hour + 2*time.Minute + 3*time.Second},
+		{"PT10H", 10 * time.Hour},
+		{"P1D", 24 * time.Hour},
+		{"P1DT2H3M", 26*time.Hour + 3*time.Minute},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1W2D", 9 * 24 * time.Hour},
+		{"PT1.5S", 1500 * time.Millisecond},
+		{"PT1,5S", 1500 * time.Millisecond},
+		{"PT1M0.25S", time.Minute + 250*time.Millisecond},
+		{"PT0.5H", 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.value)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) returned error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDurationInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"1H",
+		"P",
+		"PT",
+		"P1Y",
+		"P1M",
+		"PT1H1H",
+		"PT1S1M",
+		"P1H",
+		"PTT1S",
+		"PT1",
+		"PTS",
+		"PT1.5M3S",
+		"PT.5S",
+		"PT1.S",
+		"PT1.2.3S",
+		"PT-1S",
+		"PT99999999999999999999S",
+		"P99999999999999D",
+	}
+
+	for _, value := range tests {
+		_, err := ParseDuration(value)
+		if err == nil {
+			t.Errorf("ParseDuration(%q) should return error", value)
+			continue
+		}
+		if _, ok := err.(ErrInvalidDuration); !ok {
+			t.Errorf("ParseDuration(%q) returned %T, want ErrInvalidDuration", value, err)
+		}
+	}
+}
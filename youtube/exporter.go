@@ -0,0 +1,407 @@
+// SiroChannelの動画情報をFirestoreにエクスポートする
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	yt "google.golang.org/api/youtube/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/jobrun"
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/logging"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+type videoInfoPart struct {
+	ID          string    `firestore:"id"`
+	Title       string    `firestore:"title"`
+	PublishedAt time.Time `firestore:"publishedAt"`
+}
+
+const timeLayout = "2006-01-02T15:04:05Z07:00"
+
+func getChannel(ctx context.Context, service *yt.Service, channelID string) (*yt.Channel, error) {
+	countCall(ctx, "channels.list")
+	res, err := service.Channels.List("contentDetails").Id(channelID).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Items[0], nil
+}
+
+// digVideoInfoPart 指定された日付より新しく公開された動画の情報を取得する
+func digVideoInfoPart(ctx context.Context, service *yt.Service, playlistID string, latestVideoID string, latestVideoPublishedAt time.Time) ([]videoInfoPart, error) {
+	nextPageToken := ""
+
+	videoMap := map[string]videoInfoPart{}
+	oldCount := 0
+
+	for {
+		countCall(ctx, "playlistItems.list")
+		res, err := service.PlaylistItems.List("snippet").
+			PlaylistId(playlistID).
+			MaxResults(50).
+			PageToken(nextPageToken).
+			Do()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, playlistItem := range res.Items {
+			publishedAt, err := time.Parse(timeLayout, playlistItem.Snippet.PublishedAt)
+			if err != nil {
+				return nil, err
+			}
+
+			publishedAtLocal := publishedAt.In(broadcast.Location)
+
+			part := videoInfoPart{
+				ID:          playlistItem.Snippet.ResourceId.VideoId,
+				Title:       playlistItem.Snippet.Title,
+				PublishedAt: publishedAtLocal,
+			}
+
+			_, ok := videoMap[part.ID]
+			if ok {
+				continue
+			}
+
+			if latestVideoID == part.ID || publishedAt.Before(latestVideoPublishedAt) {
+				oldCount++
+			}
+
+			videoMap[part.ID] = part
+		}
+
+		// PlayListItemsは新しく投稿された順になっていない(アップロードされた順?)
+		// 古いのを10個以上見つけた場合は最新の物を取得できている可能性が高い
+		if oldCount > 10 {
+			break
+		}
+
+		nextPageToken = res.NextPageToken
+		if nextPageToken == "" {
+			break
+		}
+	}
+
+	result := make([]videoInfoPart, 0, len(videoMap))
+	for _, part := range videoMap {
+		if latestVideoID == part.ID || part.PublishedAt.Before(latestVideoPublishedAt) {
+			continue
+		}
+		result = append(result, part)
+	}
+
+	return result, nil
+}
+
+type videoDetail struct {
+	Duration time.Duration
+	// DurationErr contentDetails.durationを解析できなかった場合
+	DurationErr          error
+	LiveBroadcastContent string
+}
+
+// digVideoDetails 動画の長さと配信の状態を取得する
+// 削除された動画や非公開になった動画は結果に含まれない
+func digVideoDetails(ctx context.Context, service *yt.Service, videoIds []string) (map[string]videoDetail, error) {
+	videoIdsStr := strings.Join(videoIds, ",")
+	countCall(ctx, "videos.list")
+	res, err := service.Videos.List("contentDetails,snippet").Id(videoIdsStr).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]videoDetail{}
+
+	for _, video := range res.Items {
+		var d videoDetail
+		d.Duration, d.DurationErr = ParseDuration(video.ContentDetails.Duration)
+		if video.Snippet != nil {
+			d.LiveBroadcastContent = video.Snippet.LiveBroadcastContent
+		}
+		result[video.Id] = d
+	}
+
+	return result, nil
+}
+
+type ErrCanNotGetDuration string
+
+func (s ErrCanNotGetDuration) Error() string {
+	return fmt.Sprintf("Can not get duration: video id :%v", string(s))
+}
+
+// ExportVideos channelIDのチャンネルの動画を取り込む
+// 同時に実行されると同じNumberが割り振られてしまうので、ロックを取得してから行う
+// 他で実行中の場合は何もしない
+// ライブ配信やプレミア公開などの長さが決まっていない動画は保留して、次回以降に長さが決まってから取り込む
+func ExportVideos(ctx context.Context, service *yt.Service, storeClient *firestore.Client, channelID string) error {
+	lock, err := lease.AcquireLock(ctx, storeClient, "export-video", lease.ExportTTL)
+	if _, ok := err.(lease.ErrLockHeld); ok {
+		logging.Info(ctx, "export video is running on another job", nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	channel, err := getChannel(ctx, service, channelID)
+	if err != nil {
+		return err
+	}
+
+	videoStatisticsDoc := storeClient.Collection("Info").Doc("VideoStatistics")
+	metrics.CountFirestoreReads("statistics", 1)
+	s, err := videoStatisticsDoc.Get(ctx)
+	var statistics library.Statistics
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	var latestVideoID string
+	var latestVideoPublishedAt time.Time
+	if s.Exists() {
+		s.DataTo(&statistics)
+		latestVideoID = statistics.LatestVideoID
+		latestVideoPublishedAt = statistics.LatestVideoPublishedAt
+	}
+
+	pendingList, err := ListPendingVideos(ctx, storeClient)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]PendingVideo, len(pendingList))
+	for _, v := range pendingList {
+		pending[v.ID] = v
+	}
+
+	parts, err := digVideoInfoPart(ctx, service, channel.ContentDetails.RelatedPlaylists.Uploads, latestVideoID, latestVideoPublishedAt)
+	if err != nil {
+		return err
+	}
+
+	// 保留している動画も一緒に確認する
+	newIDs := make(map[string]struct{}, len(parts))
+	for _, part := range parts {
+		newIDs[part.ID] = struct{}{}
+	}
+	for _, v := range pendingList {
+		if _, ok := newIDs[v.ID]; !ok {
+			parts = append(parts, videoInfoPart{
+				ID:          v.ID,
+				Title:       v.Title,
+				PublishedAt: v.PublishedAt,
+			})
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PublishedAt.Before(parts[j].PublishedAt)
+	})
+
+	collection := storeClient.Collection("Video")
+	pendingCollection := storeClient.Collection("PendingVideo")
+
+	var tempParts []videoInfoPart
+	var exportedVideos []library.Video
+	var latestVideo library.Video
+	// latestSeen 次回はこれより新しい動画だけを取得する
+	latestSeen := videoInfoPart{ID: latestVideoID, PublishedAt: latestVideoPublishedAt}
+	exportCount := 0
+	deferCount := 0
+	export := func() error {
+		if len(tempParts) == 0 {
+			return nil
+		}
+
+		videoIds := make([]string, 0, len(tempParts))
+		for _, part := range tempParts {
+			videoIds = append(videoIds, part.ID)
+		}
+
+		details, err := digVideoDetails(ctx, service, videoIds)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		videos := make([]library.Video, 0, len(tempParts))
+		var deferred []PendingVideo
+		var resolved []string
+		for _, part := range tempParts {
+			p, wasPending := pending[part.ID]
+			d, ok := details[part.ID]
+			if !ok {
+				// 保留中に削除されたり非公開になった動画は諦める
+				if wasPending {
+					resolved = append(resolved, part.ID)
+					continue
+				}
+				return ErrCanNotGetDuration(part.ID)
+			}
+
+			firstSeenAt := now
+			if wasPending {
+				firstSeenAt = p.FirstSeenAt
+			}
+			disposition, reason := classifyVideo(d, firstSeenAt, now)
+			switch disposition {
+			case videoDefer:
+				if !wasPending {
+					logging.Info(ctx, "video deferred", logging.Fields{
+						"videoId": part.ID,
+						"reason":  reason,
+					})
+				}
+				deferred = append(deferred, PendingVideo{
+					ID:                   part.ID,
+					Title:                part.Title,
+					PublishedAt:          part.PublishedAt,
+					LiveBroadcastContent: d.LiveBroadcastContent,
+					FirstSeenAt:          firstSeenAt,
+					CheckedAt:            now,
+				})
+				continue
+			case videoReject:
+				metrics.VideosRejected.WithLabelValues(reason).Inc()
+				logging.Warning(ctx, "video rejected", logging.Fields{
+					"videoId":  part.ID,
+					"reason":   reason,
+					"duration": d.Duration,
+					"error":    d.DurationErr,
+				})
+				if wasPending {
+					resolved = append(resolved, part.ID)
+				}
+				continue
+			}
+
+			if wasPending {
+				resolved = append(resolved, part.ID)
+			}
+			videos = append(videos, library.Video{
+				ID:          part.ID,
+				Title:       part.Title,
+				PublishedAt: part.PublishedAt,
+				Duration:    d.Duration,
+				Number:      statistics.VideoCount + exportCount + len(videos),
+			})
+		}
+
+		// ロックを失っている場合は他のジョブが同じNumberを割り振っている可能性があるので書き込まない
+		err = lock.RunFenced(ctx, func(tx *firestore.Transaction) error {
+			for _, video := range videos {
+				err := tx.Set(collection.Doc(video.ID), video)
+				if err != nil {
+					return err
+				}
+			}
+			for _, v := range deferred {
+				err := tx.Set(pendingCollection.Doc(v.ID), v)
+				if err != nil {
+					return err
+				}
+			}
+			for _, id := range resolved {
+				err := tx.Delete(pendingCollection.Doc(id))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range deferred {
+			pending[v.ID] = v
+		}
+		for _, id := range resolved {
+			delete(pending, id)
+		}
+		for _, part := range tempParts {
+			if part.PublishedAt.After(latestSeen.PublishedAt) {
+				latestSeen = part
+			}
+		}
+		deferCount += len(deferred)
+		exportCount += len(videos)
+		exportedVideos = append(exportedVideos, videos...)
+		if len(videos) > 0 {
+			latestVideo = videos[len(videos)-1]
+		}
+
+		tempParts = []videoInfoPart{}
+		return nil
+	}
+
+	var lastErr error
+
+	for _, part := range parts {
+		tempParts = append(tempParts, part)
+		if len(tempParts) >= 50 {
+			err := export()
+			if err != nil {
+				lastErr = err
+				break
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = export()
+	}
+	metrics.VideosPending.Set(float64(len(pending)))
+
+	if exportCount > 0 || latestSeen.ID != latestVideoID {
+		err := lock.RunFenced(ctx, func(tx *firestore.Transaction) error {
+			return tx.Set(videoStatisticsDoc, library.Statistics{
+				LatestVideoID:          latestSeen.ID,
+				LatestVideoPublishedAt: latestSeen.PublishedAt,
+				VideoCount:             statistics.VideoCount + exportCount,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if deferCount > 0 {
+		logging.Info(ctx, "videos pending", logging.Fields{
+			"count": len(pending),
+		})
+	}
+
+	if exportCount > 0 {
+		metrics.VideosIngested.Add(float64(exportCount))
+		jobrun.FromContext(ctx).AddVideos(exportCount)
+		logging.Info(ctx, "export video", logging.Fields{
+			"count":       exportCount,
+			"latestTitle": latestVideo.Title,
+			"latestId":    latestVideo.ID,
+			"videoCount":  statistics.VideoCount + exportCount,
+		})
+
+		err = library.AppendIndex(ctx, storeClient, statistics.VideoCount, exportedVideos)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,129 @@
+// ライブ配信の検出
+// 同時放送のために数分ごとに呼ばれるので、クォータを消費しないようにアップロードの最初のページと
+// 保留している配信予定の動画だけを確認する
+package youtube
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	yt "google.golang.org/api/youtube/v3"
+)
+
+// liveCandidateCount アップロードの新しいものから確認する数
+const liveCandidateCount = 10
+
+// LiveStream 配信中のライブ
+type LiveStream struct {
+	VideoID   string
+	Title     string
+	StartedAt time.Time
+}
+
+var (
+	uploadsPlaylistMu sync.Mutex
+	// uploadsPlaylistIDs チャンネルのIDごとのアップロードのプレイリスト
+	uploadsPlaylistIDs = map[string]string{}
+)
+
+// getUploadsPlaylistID チャンネルのアップロードのプレイリストは変わらないのでチャンネルごとに一度だけ取得する
+func getUploadsPlaylistID(ctx context.Context, service *yt.Service, channelID string) (string, error) {
+	uploadsPlaylistMu.Lock()
+	defer uploadsPlaylistMu.Unlock()
+
+	if id, ok := uploadsPlaylistIDs[channelID]; ok {
+		return id, nil
+	}
+
+	channel, err := getChannel(ctx, service, channelID)
+	if err != nil {
+		return "", err
+	}
+
+	id := channel.ContentDetails.RelatedPlaylists.Uploads
+	uploadsPlaylistIDs[channelID] = id
+	return id, nil
+}
+
+// FindLive channelIDのチャンネルで配信中のライブを探す
+// 配信していない場合はfalseを返す、複数ある場合は最後に始まったものを返す
+func FindLive(ctx context.Context, service *yt.Service, storeClient *firestore.Client, channelID string) (LiveStream, bool, error) {
+	playlistID, err := getUploadsPlaylistID(ctx, service, channelID)
+	if err != nil {
+		return LiveStream{}, false, err
+	}
+
+	countCall(ctx, "playlistItems.list")
+	res, err := service.PlaylistItems.List("snippet").
+		PlaylistId(playlistID).
+		MaxResults(liveCandidateCount).
+		Do()
+	if err != nil {
+		return LiveStream{}, false, err
+	}
+
+	ids := []string{}
+	seen := map[string]struct{}{}
+	add := func(id string) {
+		if _, ok := seen[id]; ok || len(ids) >= 50 {
+			return
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	// 配信予定として保留している動画はアップロードの最初のページにないことがある
+	pending, err := ListPendingVideos(ctx, storeClient)
+	if err != nil {
+		return LiveStream{}, false, err
+	}
+	for _, v := range pending {
+		if v.LiveBroadcastContent == LiveBroadcastLive || v.LiveBroadcastContent == LiveBroadcastUpcoming {
+			add(v.ID)
+		}
+	}
+	for _, item := range res.Items {
+		add(item.Snippet.ResourceId.VideoId)
+	}
+	if len(ids) == 0 {
+		return LiveStream{}, false, nil
+	}
+
+	countCall(ctx, "videos.list")
+	videos, err := service.Videos.List("snippet,liveStreamingDetails").Id(strings.Join(ids, ",")).Do()
+	if err != nil {
+		return LiveStream{}, false, err
+	}
+
+	var result LiveStream
+	found := false
+	for _, video := range videos.Items {
+		if video.Snippet == nil || video.Snippet.LiveBroadcastContent != LiveBroadcastLive {
+			continue
+		}
+		details := video.LiveStreamingDetails
+		if details == nil || details.ActualStartTime == "" || details.ActualEndTime != "" {
+			continue
+		}
+
+		startedAt, err := time.Parse(time.RFC3339, details.ActualStartTime)
+		if err != nil {
+			return LiveStream{}, false, err
+		}
+		if found && !startedAt.After(result.StartedAt) {
+			continue
+		}
+
+		result = LiveStream{
+			VideoID:   video.Id,
+			Title:     video.Snippet.Title,
+			StartedAt: startedAt,
+		}
+		found = true
+	}
+
+	return result, found, nil
+}
@@ -0,0 +1,84 @@
+// 配信中・配信予定のライブ、公開前のプレミア、処理中で長さが0の動画
+// アーカイブになって長さが決まるまでPendingVideoコレクションに保存しておき、以降のエクスポートで取り込む
+package youtube
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// snippet.liveBroadcastContentの値
+const (
+	LiveBroadcastNone     = "none"
+	LiveBroadcastLive     = "live"
+	LiveBroadcastUpcoming = "upcoming"
+)
+
+// pendingZeroDurationLimit 配信が終わっても長さが0のままの動画はこの時間が経つと諦める
+const pendingZeroDurationLimit = 3 * 24 * time.Hour
+
+// PendingVideo 取り込みを保留している動画
+type PendingVideo struct {
+	ID          string    `firestore:"id" json:"id"`
+	Title       string    `firestore:"title" json:"title"`
+	PublishedAt time.Time `firestore:"publishedAt" json:"publishedAt"`
+	// LiveBroadcastContent 最後に確認したときのsnippet.liveBroadcastContent
+	LiveBroadcastContent string    `firestore:"liveBroadcastContent" json:"liveBroadcastContent"`
+	FirstSeenAt          time.Time `firestore:"firstSeenAt" json:"firstSeenAt"`
+	CheckedAt            time.Time `firestore:"checkedAt" json:"checkedAt"`
+}
+
+type videoDisposition int
+
+const (
+	videoIngest videoDisposition = iota
+	videoDefer
+	videoReject
+)
+
+// classifyVideo 動画を取り込むか保留するかを決める
+// 保留、または取り込まない場合は理由も返す
+func classifyVideo(d videoDetail, firstSeenAt, now time.Time) (videoDisposition, string) {
+	switch d.LiveBroadcastContent {
+	case LiveBroadcastLive, LiveBroadcastUpcoming:
+		return videoDefer, d.LiveBroadcastContent
+	}
+
+	if d.DurationErr != nil {
+		return videoReject, "invalid_duration"
+	}
+	if d.Duration <= 0 {
+		// 配信が終わった直後は長さが決まっていないことがある
+		if now.Sub(firstSeenAt) < pendingZeroDurationLimit {
+			return videoDefer, "zero_duration"
+		}
+		return videoReject, "zero_duration"
+	}
+
+	return videoIngest, ""
+}
+
+// ListPendingVideos 保留している動画を返す
+func ListPendingVideos(ctx context.Context, storeClient *firestore.Client) ([]PendingVideo, error) {
+	docs, err := storeClient.Collection("PendingVideo").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	metrics.CountFirestoreReads("pending_video", len(docs))
+
+	result := make([]PendingVideo, 0, len(docs))
+	for _, doc := range docs {
+		var v PendingVideo
+		err = doc.DataTo(&v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+
+	return result, nil
+}
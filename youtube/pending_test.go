@@ -0,0 +1,77 @@
+package youtube
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClassifyVideo(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		d           videoDetail
+		firstSeenAt time.Time
+		want        videoDisposition
+		reason      string
+	}{
+		{
+			name:        "upcoming",
+			d:           videoDetail{LiveBroadcastContent: LiveBroadcastUpcoming},
+			firstSeenAt: now,
+			want:        videoDefer,
+			reason:      "upcoming",
+		},
+		{
+			// 配信中は長さが決まっていても保留する
+			name:        "live",
+			d:           videoDetail{Duration: time.Hour, LiveBroadcastContent: LiveBroadcastLive},
+			firstSeenAt: now.Add(-7 * 24 * time.Hour),
+			want:        videoDefer,
+			reason:      "live",
+		},
+		{
+			name:        "processing",
+			d:           videoDetail{LiveBroadcastContent: LiveBroadcastNone},
+			firstSeenAt: now.Add(-time.Hour),
+			want:        videoDefer,
+			reason:      "zero_duration",
+		},
+		{
+			// 長さが決まらないまま時間が経った動画は諦める
+			name:        "processing too long",
+			d:           videoDetail{LiveBroadcastContent: LiveBroadcastNone},
+			firstSeenAt: now.Add(-pendingZeroDurationLimit),
+			want:        videoReject,
+			reason:      "zero_duration",
+		},
+		{
+			name:        "invalid duration",
+			d:           videoDetail{DurationErr: errors.New("invalid"), LiveBroadcastContent: LiveBroadcastNone},
+			firstSeenAt: now,
+			want:        videoReject,
+			reason:      "invalid_duration",
+		},
+		{
+			name:        "accepted",
+			d:           videoDetail{Duration: 20 * time.Minute, LiveBroadcastContent: LiveBroadcastNone},
+			firstSeenAt: now,
+			want:        videoIngest,
+		},
+		{
+			// 長すぎる動画も取り込み、編成するかはスケジュールの作成時に決める
+			name:        "too long video",
+			d:           videoDetail{Duration: 10 * time.Hour, LiveBroadcastContent: LiveBroadcastNone},
+			firstSeenAt: now,
+			want:        videoIngest,
+		},
+	}
+
+	for _, tt := range tests {
+		got, reason := classifyVideo(tt.d, tt.firstSeenAt, now)
+		if got != tt.want || reason != tt.reason {
+			t.Errorf("%v: classifyVideo = %v, %q, want %v, %q", tt.name, got, reason, tt.want, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// ソースとして登録したプレイリストの取り込み
+// プレイリストは並び替えや削除があるので、毎回すべての動画を取得して置き換える
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	yt "google.golang.org/api/youtube/v3"
+
+	"github.com/yaegaki/ohohoi-bank/broadcast"
+	"github.com/yaegaki/ohohoi-bank/lease"
+	"github.com/yaegaki/ohohoi-bank/library"
+	"github.com/yaegaki/ohohoi-bank/logging"
+)
+
+type ErrPlaylistNotExists string
+
+func (s ErrPlaylistNotExists) Error() string {
+	return fmt.Sprintf("playlist not exists: %v", string(s))
+}
+
+// digPlaylist プレイリストのタイトルと動画をプレイリストの順番で取得する
+// 同じ動画が複数回含まれている場合はそのまま返す
+func digPlaylist(ctx context.Context, service *yt.Service, playlistID string) (string, []videoInfoPart, error) {
+	countCall(ctx, "playlists.list")
+	playlists, err := service.Playlists.List("snippet").Id(playlistID).Do()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(playlists.Items) == 0 {
+		return "", nil, ErrPlaylistNotExists(playlistID)
+	}
+	title := playlists.Items[0].Snippet.Title
+
+	type positioned struct {
+		position int64
+		part     videoInfoPart
+	}
+	var items []positioned
+	nextPageToken := ""
+	for {
+		countCall(ctx, "playlistItems.list")
+		res, err := service.PlaylistItems.List("snippet,contentDetails").
+			PlaylistId(playlistID).
+			MaxResults(50).
+			PageToken(nextPageToken).
+			Do()
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, playlistItem := range res.Items {
+			// snippet.publishedAtはプレイリストに追加された日時なので動画の公開日時を使う
+			// 削除された動画や非公開の動画は公開日時が空になる
+			var publishedAt time.Time
+			if s := playlistItem.ContentDetails.VideoPublishedAt; s != "" {
+				publishedAt, err = time.Parse(time.RFC3339, s)
+				if err != nil {
+					return "", nil, err
+				}
+			}
+
+			items = append(items, positioned{
+				position: playlistItem.Snippet.Position,
+				part: videoInfoPart{
+					ID:          playlistItem.ContentDetails.VideoId,
+					Title:       playlistItem.Snippet.Title,
+					PublishedAt: publishedAt.In(broadcast.Location),
+				},
+			})
+		}
+
+		nextPageToken = res.NextPageToken
+		if nextPageToken == "" {
+			break
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].position < items[j].position
+	})
+	parts := make([]videoInfoPart, 0, len(items))
+	for _, it := range items {
+		parts = append(parts, it.part)
+	}
+
+	return title, parts, nil
+}
+
+// ExportPlaylists playlistIDsのプレイリストを取り込む
+// 取り込めなかったプレイリストがあっても残りは続けて、最後のエラーを返す
+func ExportPlaylists(ctx context.Context, service *yt.Service, storeClient *firestore.Client, playlistIDs []string) error {
+	if len(playlistIDs) == 0 {
+		return nil
+	}
+
+	lock, err := lease.AcquireLock(ctx, storeClient, "export-playlist", lease.ExportTTL)
+	if _, ok := err.(lease.ErrLockHeld); ok {
+		logging.Info(ctx, "export playlist is running on another job", nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release(ctx)
+
+	var lastErr error
+	for _, id := range playlistIDs {
+		err := exportPlaylist(ctx, service, storeClient, lock, id)
+		if err != nil {
+			logging.Warning(ctx, "Can't export playlist", logging.Fields{
+				"playlistId": id,
+				"error":      err,
+			})
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// exportPlaylist プレイリストを取得して置き換える
+// ライブ配信などの長さが決まっていない動画は含めず、次回以降に長さが決まってから含める
+func exportPlaylist(ctx context.Context, service *yt.Service, storeClient *firestore.Client, lock *lease.Lock, playlistID string) error {
+	title, parts, err := digPlaylist(ctx, service, playlistID)
+	if err != nil {
+		return err
+	}
+
+	details := map[string]videoDetail{}
+	requested := map[string]struct{}{}
+	var videoIds []string
+	flush := func() error {
+		if len(videoIds) == 0 {
+			return nil
+		}
+
+		res, err := digVideoDetails(ctx, service, videoIds)
+		if err != nil {
+			return err
+		}
+		for id, d := range res {
+			details[id] = d
+		}
+
+		videoIds = nil
+		return nil
+	}
+	for _, part := range parts {
+		if _, ok := requested[part.ID]; ok || part.PublishedAt.IsZero() {
+			continue
+		}
+		requested[part.ID] = struct{}{}
+		videoIds = append(videoIds, part.ID)
+		if len(videoIds) >= 50 {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = flush()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	items := make([]library.PlaylistItem, 0, len(parts))
+	skipped := 0
+	for _, part := range parts {
+		// 削除された動画や非公開の動画は結果に含まれない
+		d, ok := details[part.ID]
+		if !ok {
+			skipped++
+			continue
+		}
+		if disposition, _ := classifyVideo(d, now, now); disposition != videoIngest {
+			skipped++
+			continue
+		}
+
+		items = append(items, library.PlaylistItem{
+			VideoID:     part.ID,
+			Title:       part.Title,
+			PublishedAt: part.PublishedAt,
+			Duration:    d.Duration,
+		})
+	}
+
+	err = lock.RunFenced(ctx, func(tx *firestore.Transaction) error {
+		return tx.Set(library.PlaylistDoc(storeClient, playlistID), library.Playlist{
+			ID:        playlistID,
+			Title:     title,
+			Items:     items,
+			UpdatedAt: now,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.Info(ctx, "export playlist", logging.Fields{
+		"playlistId": playlistID,
+		"title":      title,
+		"count":      len(items),
+		"skipped":    skipped,
+	})
+	return nil
+}
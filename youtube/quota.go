@@ -0,0 +1,24 @@
+// YouTube Data APIのクォータの記録
+package youtube
+
+import (
+	"context"
+
+	"github.com/yaegaki/ohohoi-bank/jobrun"
+	"github.com/yaegaki/ohohoi-bank/metrics"
+)
+
+// YouTube Data APIの各メソッドで消費するクォータ
+var quotaCost = map[string]float64{
+	"channels.list":      1,
+	"playlistItems.list": 1,
+	"playlists.list":     1,
+	"videos.list":        1,
+}
+
+// countCall ジョブの実行中であれば実行履歴にもクォータを記録する
+func countCall(ctx context.Context, method string) {
+	metrics.YoutubeCalls.WithLabelValues(method).Inc()
+	metrics.YoutubeQuota.WithLabelValues(method).Add(quotaCost[method])
+	jobrun.FromContext(ctx).AddQuota(quotaCost[method])
+}
@@ -0,0 +1,32 @@
+// YouTube Data APIのクライアント
+package youtube
+
+import (
+	"context"
+
+	"golang.org/x/oauth2/google"
+	yt "google.golang.org/api/youtube/v3"
+
+	"github.com/yaegaki/ohohoi-bank/logging"
+)
+
+// NewService デフォルトの認証情報でYouTube Data APIのクライアントを作成する
+func NewService(ctx context.Context) (*yt.Service, error) {
+	client, err := google.DefaultClient(context.Background(), yt.YoutubeReadonlyScope)
+	if err != nil {
+		logging.Error(ctx, "Error creating google client", logging.Fields{
+			"error": err,
+		})
+		return nil, err
+	}
+
+	service, err := yt.New(client)
+	if err != nil {
+		logging.Error(ctx, "Error creating YouTube client", logging.Fields{
+			"error": err,
+		})
+		return nil, err
+	}
+
+	return service, nil
+}